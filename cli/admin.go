@@ -27,9 +27,11 @@ Priority:       {{.Priority}}
 {{end}}
 `
 	TmplSizes = `JobId                 		Context Size    Output Size    Log Size    Total Size
-{{range .}}{{.Id}}	{{format .Context}}	{{format .Output}}	{{format .Log}}	{{ total . | format}}
+{{range .}}{{.Id}}	{{format .Context}}	{{format .Output}}	{{format .Log}}	{{format .Total}}
 {{end}}
 
+`
+	TmplSizesTotal = `Total {{format .Total}}
 `
 )
 
@@ -144,32 +146,49 @@ func (c *Cli) AddPropertyListCommand(link PipelineLink) {
 		withTemplate(TmplProperties).buildAdmin(c)
 }
 
+//Size of the data a job keeps in the server
+type jobDataSize struct {
+	Id      string `json:"id"`
+	Context int    `json:"context"`
+	Output  int    `json:"output"`
+	Log     int    `json:"log"`
+	Total   int    `json:"total"`
+}
+
+//Total size of the jobs' data in the server
+type dataSizeTotal struct {
+	Total int `json:"total"`
+}
+
 func (c *Cli) AddSizesCommand(link PipelineLink) {
 	list := false
 	unitFormatter := func(size int) string {
 		return fmt.Sprintf("%d", size)
 	}
-	cmd := c.AddAdminCommand("sizes", "Prints the total size or a detailed list of job data stored in the server",
-		func(command string, args ...string) error {
-			sizes, err := link.Sizes()
-			if err != nil {
-				return err
-			}
-			if !list {
-				c.Printf("Total %s\n", unitFormatter(sizes.Total))
-			} else {
-				funcMap := template.FuncMap{
-					"format": unitFormatter,
-					"total": func(size pipeline.JobSize) int {
-						return size.Context + size.Output + size.Log
-					},
-				}
-				tmpl := template.Must(template.New("sizes").Funcs(funcMap).Parse(TmplSizes))
-				err = tmpl.Execute(c.Output, sizes.JobSizes)
-			}
-
-			return err
-		})
+	builder := newCommandBuilder("sizes", "Prints the total size or a detailed list of job data stored in the server")
+	cmd := builder.withCall(func(args ...string) (interface{}, error) {
+		sizes, err := link.Sizes()
+		if err != nil {
+			return nil, err
+		}
+		builder.withFuncs(template.FuncMap{"format": unitFormatter})
+		if !list {
+			builder.withTemplate(TmplSizesTotal)
+			return dataSizeTotal{Total: sizes.Total}, nil
+		}
+		builder.withTemplate(TmplSizes)
+		jobs := []jobDataSize{}
+		for _, size := range sizes.JobSizes {
+			jobs = append(jobs, jobDataSize{
+				Id:      size.Id,
+				Context: size.Context,
+				Output:  size.Output,
+				Log:     size.Log,
+				Total:   size.Context + size.Output + size.Log,
+			})
+		}
+		return jobs, nil
+	}).buildAdmin(c)
 	cmd.AddSwitch("list", "l", "Displays a detailed list rather than the total size", func(string, string) error {
 		list = true
 		return nil
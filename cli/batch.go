@@ -0,0 +1,302 @@
+package cli
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/daisy/pipeline-clientlib-go"
+	"launchpad.net/goyaml"
+)
+
+const (
+	BatchSummaryTemplate = `Row	Script	Job Id	[STATUS]	Output
+{{range .}}{{.Row}}	{{.Script}}	{{.JobId}}	[{{.Status}}]	{{.Output}}{{if .Error}}	({{.Error}}){{end}}
+{{end}}`
+)
+
+//Manifest columns/keys that are not passed to the script as inputs or options
+var batchReservedKeys = []string{"script", "output", "inputs", "options"}
+
+//Manifest columns/keys that are passed to the script command as switches
+var batchSwitches = []string{"zip", "persistent"}
+
+//A single conversion described in a batch manifest
+type batchRow struct {
+	Script string   //Script id
+	Output string   //Where to store the results
+	Args   []string //Script flags as they would be written in the command line
+}
+
+//Outcome of a batch row
+type batchResult struct {
+	Row    int
+	Script string
+	JobId  string
+	Status string
+	Output string
+	Error  string
+}
+
+func AddBatchCommand(cli *Cli, link *PipelineLink) {
+	concurrency := 1
+	summaryPath := ""
+	builder := newCommandBuilder("batch", "Runs the conversions listed in a YAML or CSV manifest").
+		withTemplate(BatchSummaryTemplate)
+	fn := func(args ...string) (interface{}, error) {
+		rows, err := loadManifest(args[0])
+		if err != nil {
+			return nil, err
+		}
+		results := runBatch(rows, link, concurrency)
+		if summaryPath != "" {
+			if err := writeBatchSummary(summaryPath, results); err != nil {
+				return nil, err
+			}
+		}
+		failed := 0
+		for _, res := range results {
+			if res.Status != "SUCCESS" {
+				failed++
+			}
+		}
+		if failed > 0 {
+			if err := builder.writeOutput(results, cli); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%v of %v jobs did not finish successfully", failed, len(results))
+		}
+		return results, nil
+	}
+	cmd := builder.withCall(fn).build(cli)
+	cmd.SetArity(1, "MANIFEST")
+	cmd.AddOption("concurrency", "c", "Maximum number of jobs running at the same time (default 1)", "", "", func(name, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return ValidationError{fmt.Errorf("option %v must be a positive number (found %v)", name, value)}
+		}
+		concurrency = n
+		return nil
+	})
+	cmd.AddOption("summary", "s", "Write the status and output location of every row to a CSV file", "", "FILE", func(name, path string) error {
+		summaryPath = path
+		return nil
+	})
+}
+
+//Loads the manifest rows, the format is chosen after the file extension
+func loadManifest(path string) ([]batchRow, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return manifestFromCsv(file)
+	case ".yml", ".yaml":
+		return manifestFromYaml(file)
+	default:
+		return nil, ValidationError{fmt.Errorf("Unknown manifest format %v (expected .csv, .yml or .yaml)", path)}
+	}
+}
+
+//Reads a CSV manifest. The first line is the header, the script and output columns
+//are mandatory and the rest of columns are taken as script inputs or options.
+//Empty cells are ignored
+func manifestFromCsv(r io.Reader) (rows []batchRow, err error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, ValidationError{err}
+	}
+	if len(records) == 0 {
+		return nil, ValidationError{errors.New("The manifest is empty")}
+	}
+	header := records[0]
+	for idx, record := range records[1:] {
+		values := map[string]interface{}{}
+		for col, name := range header {
+			if col < len(record) && record[col] != "" {
+				values[strings.TrimSpace(name)] = record[col]
+			}
+		}
+		row, err := newBatchRow(values, idx+1)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+//Reads a YAML manifest consisting of a list of entries with script, output, inputs and options keys.
+//Other keys (e.g. nicename, priority or data) are passed to the script command as well
+func manifestFromYaml(r io.Reader) (rows []batchRow, err error) {
+	bytes, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	entries := []map[string]interface{}{}
+	if err = goyaml.Unmarshal(bytes, &entries); err != nil {
+		return nil, ValidationError{err}
+	}
+	for idx, entry := range entries {
+		values := map[string]interface{}{}
+		for key, value := range entry {
+			switch key {
+			case "inputs", "options":
+				group, ok := value.(map[interface{}]interface{})
+				if !ok {
+					return nil, ValidationError{fmt.Errorf("Row %v: %v must be a map", idx+1, key)}
+				}
+				for name, v := range group {
+					values[fmt.Sprint(name)] = v
+				}
+			default:
+				values[key] = value
+			}
+		}
+		row, err := newBatchRow(values, idx+1)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+//Builds a batch row out of the manifest values
+func newBatchRow(values map[string]interface{}, idx int) (row batchRow, err error) {
+	row.Script = manifestValue(values["script"])
+	row.Output = manifestValue(values["output"])
+	if row.Script == "" {
+		return row, ValidationError{fmt.Errorf("Row %v: no script given", idx)}
+	}
+	if row.Output == "" {
+		return row, ValidationError{fmt.Errorf("Row %v: no output given", idx)}
+	}
+	//sort the names so the flags are always passed in the same order
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if contains(batchReservedKeys, name) {
+			continue
+		}
+		if contains(batchSwitches, name) {
+			if manifestValue(values[name]) == "true" {
+				row.Args = append(row.Args, "--"+name)
+			}
+			continue
+		}
+		row.Args = append(row.Args, "--"+name, manifestValue(values[name]))
+	}
+	return
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+//Converts a manifest value into its command line representation, lists are joined by commas
+func manifestValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []interface{}:
+		items := make([]string, len(v))
+		for idx, item := range v {
+			items[idx] = manifestValue(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+//Runs the rows keeping at most concurrency jobs running at the same time
+func runBatch(rows []batchRow, link *PipelineLink, concurrency int) []batchResult {
+	results := make([]batchResult, len(rows))
+	scripts := map[string]pipeline.Script{}
+	var wg sync.WaitGroup
+	slots := make(chan bool, concurrency)
+	for idx, row := range rows {
+		results[idx] = batchResult{Row: idx + 1, Script: row.Script, Output: row.Output}
+		script, ok := scripts[row.Script]
+		if !ok {
+			var err error
+			script, err = link.Script(row.Script)
+			if err != nil {
+				results[idx].Status = "INVALID"
+				results[idx].Error = err.Error()
+				continue
+			}
+			scripts[row.Script] = script
+		}
+		jExec, err := parseScriptArgs(script, link, row.Args)
+		if err != nil {
+			results[idx].Status = "INVALID"
+			results[idx].Error = err.Error()
+			continue
+		}
+		jExec.output = row.Output
+		jExec.verbose = false
+		jExec.req.Background = false
+		jExec.unattended = true
+		wg.Add(1)
+		slots <- true
+		go func(res *batchResult, jExec *jobExecution) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			job, status, output, err := jExec.execute(ioutil.Discard)
+			res.JobId = job.Id
+			res.Status = status
+			if output != "" {
+				//renamed if the output already existed
+				res.Output = output
+			}
+			if err != nil {
+				//the job's status is kept if only its hook failed
+				if _, hookFailed := err.(HookError); !hookFailed {
+					res.Status = "ERROR"
+				}
+				res.Error = err.Error()
+			}
+		}(&results[idx], jExec)
+	}
+	wg.Wait()
+	return results
+}
+
+//Writes the batch results as CSV
+func writeBatchSummary(path string, results []batchResult) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := csv.NewWriter(file)
+	w.Write([]string{"row", "script", "job", "status", "output", "error"})
+	for _, res := range results {
+		w.Write([]string{strconv.Itoa(res.Row), res.Script, res.JobId, res.Status, res.Output, res.Error})
+	}
+	w.Flush()
+	return w.Error()
+}
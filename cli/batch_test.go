@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const (
+	csvManifest = `script,output,source,another-opt,zip
+test,out/one,one.xml,foo,
+test,out/two,"a.xml,b.xml",,true
+`
+	yamlManifest = `
+- script: test
+  output: out/one
+  nicename: first
+  inputs:
+    source: [a.xml, b.xml]
+  options:
+    another-opt: bar
+`
+)
+
+//Tests that the csv columns are mapped to script flags
+func TestManifestFromCsv(t *testing.T) {
+	rows, err := manifestFromCsv(strings.NewReader(csvManifest))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+	if len(rows) != 2 {
+		t.Errorf("Wrong number of rows %v", len(rows))
+		return
+	}
+	if rows[0].Script != "test" || rows[0].Output != "out/one" {
+		t.Errorf("Script or output not set %+v", rows[0])
+	}
+	exp := "--another-opt foo --source one.xml"
+	if res := strings.Join(rows[0].Args, " "); res != exp {
+		t.Errorf("Wrong arguments '%s'!='%s'", exp, res)
+	}
+	exp = "--source a.xml,b.xml --zip"
+	if res := strings.Join(rows[1].Args, " "); res != exp {
+		t.Errorf("Wrong arguments '%s'!='%s'", exp, res)
+	}
+}
+
+//Tests that the yaml entries are mapped to script flags
+func TestManifestFromYaml(t *testing.T) {
+	rows, err := manifestFromYaml(strings.NewReader(yamlManifest))
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+	if len(rows) != 1 {
+		t.Errorf("Wrong number of rows %v", len(rows))
+		return
+	}
+	exp := "--another-opt bar --nicename first --source a.xml,b.xml"
+	if res := strings.Join(rows[0].Args, " "); res != exp {
+		t.Errorf("Wrong arguments '%s'!='%s'", exp, res)
+	}
+}
+
+//Tests that rows without output are rejected
+func TestManifestNoOutput(t *testing.T) {
+	_, err := manifestFromCsv(strings.NewReader("script,source\ntest,one.xml\n"))
+	if err == nil {
+		t.Errorf("Expected error not thrown")
+	}
+}
+
+//Tests that every row is executed and the invalid ones are reported
+func TestRunBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source.xml")
+	if err := ioutil.WriteFile(source, []byte("<doc/>"), 0644); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	rows := []batchRow{
+		batchRow{Script: "test", Output: filepath.Join(dir, "out"),
+			Args: []string{"--source", source, "--single", source, "--test-opt", source}},
+		//missing the required option
+		batchRow{Script: "test", Output: filepath.Join(dir, "out2"),
+			Args: []string{"--source", source}},
+	}
+	link := &PipelineLink{pipeline: newPipelineTest(false), FsAllow: true}
+	results := runBatch(rows, link, 2)
+	if len(results) != 2 {
+		t.Errorf("Wrong number of results %v", len(results))
+		return
+	}
+	if results[0].Status != "SUCCESS" {
+		t.Errorf("Row 1 didn't succeed %+v", results[0])
+	}
+	if results[1].Status != "INVALID" || results[1].Error == "" {
+		t.Errorf("Row 2 wasn't reported as invalid %+v", results[1])
+	}
+}
+
+func TestRunBatchHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are run through sh")
+	}
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source.xml")
+	if err := ioutil.WriteFile(source, []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	hooked := filepath.Join(dir, "hooked")
+	rows := []batchRow{
+		batchRow{Script: "test", Output: filepath.Join(dir, "out"),
+			Args: []string{"--source", source, "--single", source, "--test-opt", source}},
+		//the row's hook comes before the configured one
+		batchRow{Script: "test", Output: filepath.Join(dir, "out2"),
+			Args: []string{"--source", source, "--single", source, "--test-opt", source, "--on-success", "exit 3"}},
+	}
+	config := Config{ONSUCCESS: `echo "$DP2_STATUS $DP2_OUTPUT" > ` + hooked}
+	link := &PipelineLink{pipeline: newPipelineTest(false), FsAllow: true, config: config}
+	results := runBatch(rows, link, 1)
+	if results[0].Status != "SUCCESS" || results[0].Error != "" {
+		t.Errorf("Row 1 didn't succeed %+v", results[0])
+	}
+	content, err := ioutil.ReadFile(hooked)
+	if err != nil {
+		t.Fatalf("The configured hook wasn't run: %v", err)
+	}
+	if string(content) != "SUCCESS "+filepath.Join(dir, "out")+"\n" {
+		t.Errorf("Wrong hook environment %q", content)
+	}
+	if results[1].Status != "SUCCESS" || !strings.Contains(results[1].Error, "exit 3") {
+		t.Errorf("The failure of the row's hook wasn't reported %+v", results[1])
+	}
+}
+
+func TestRunBatchRenamedOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source.xml")
+	if err := ioutil.WriteFile(source, []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	output := filepath.Join(dir, "out")
+	if err := os.Mkdir(output, 0755); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	rows := []batchRow{
+		batchRow{Script: "test", Output: output,
+			Args: []string{"--source", source, "--single", source, "--test-opt", source}},
+	}
+	link := &PipelineLink{pipeline: newPipelineTest(false), FsAllow: true, config: Config{IFEXISTS: IF_EXISTS_RENAME}}
+	results := runBatch(rows, link, 1)
+	if results[0].Status != "SUCCESS" || results[0].Output != output+"-1" {
+		t.Errorf("The renamed output wasn't reported %+v", results[0])
+	}
+	summary := filepath.Join(dir, "summary.csv")
+	if err := writeBatchSummary(summary, results); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if content, _ := ioutil.ReadFile(summary); !strings.Contains(string(content), output+"-1") {
+		t.Errorf("The renamed output isn't in the summary %q", content)
+	}
+}
@@ -102,6 +102,9 @@ type Cli struct {
 	StaticCommands []*subcommand.Command //commands which are always present
 	AdminCommands  []*subcommand.Command //admin commands
 	Output         io.Writer             //writer where to dump the output
+	rawParams      map[string]int        //number of params parsed by the raw commands
+	rawArgs        []string              //arguments left unparsed after the params of a raw command
+	format         string                //format of the commands' data, their text output if empty
 }
 
 //Script commands have a job request associated
@@ -127,8 +130,7 @@ func NewCli(name string, link *PipelineLink) (cli *Cli, err error) {
 		}
 		scripts, err := link.Scripts()
 		if err != nil {
-			fmt.Printf("Error loading scripts:\n\t%v\n", err)
-			os.Exit(-1)
+			return linkError(fmt.Errorf("Error loading scripts: %w", err))
 		}
 		cli.AddScripts(scripts, link)
 		for _, cmd := range cli.Scripts {
@@ -140,6 +142,7 @@ func NewCli(name string, link *PipelineLink) (cli *Cli, err error) {
 	})
 	//add config flags
 	cli.addConfigOptions(link.config)
+	cli.addFormatOption()
 	return
 }
 
@@ -177,7 +180,7 @@ func (c *Cli) addConfigOptions(conf Config) {
 			case int:
 				val, err := strconv.Atoi(value)
 				if err != nil {
-					return fmt.Errorf("option %v must be a numeric value (found %v)", optName, value)
+					return ValidationError{fmt.Errorf("option %v must be a numeric value (found %v)", optName, value)}
 				}
 				conf[optName] = val
 			case bool:
@@ -187,7 +190,7 @@ func (c *Cli) addConfigOptions(conf Config) {
 				case value == "false":
 					conf[optName] = false
 				default:
-					return fmt.Errorf("option %v must be true or false (found %v)", optName, value)
+					return ValidationError{fmt.Errorf("option %v must be true or false (found %v)", optName, value)}
 				}
 
 			case string:
@@ -210,6 +213,32 @@ func (c *Cli) addConfigOptions(conf Config) {
 	})
 }
 
+//Adds the global option to print the commands' data in a format that can be parsed
+func (c *Cli) addFormatOption() {
+	c.AddOption("format", "", "Print the data of the commands as "+strings.Join(outputFormats, ", ")+" instead of their text output", "", "FORMAT", func(name, format string) error {
+		if !contains(outputFormats, format) {
+			return ValidationError{fmt.Errorf("%v is not a valid value for --%v. Allowed values are %v", format, name, strings.Join(outputFormats, ", "))}
+		}
+		c.format = format
+		return nil
+	})
+}
+
+//Adds a command which only parses its first params arguments. The arguments after them are
+//left unparsed, as they belong to another command (e.g. script flags), and can be read with RawArgs
+func (c *Cli) AddRawCommand(name, desc string, params int, fn func(string, ...string) error) *subcommand.Command {
+	if c.rawParams == nil {
+		c.rawParams = map[string]int{}
+	}
+	c.rawParams[name] = params
+	return c.AddCommand(name, desc, fn)
+}
+
+//Returns the arguments left unparsed by the raw command being run
+func (c *Cli) RawArgs() []string {
+	return c.rawArgs
+}
+
 //Adds the command to the cli and stores the it into the scripts list
 func (c *Cli) AddScriptCommand(name, shortDesc string, longDesc string, fn func(string, ...string) error, request *JobRequest) *subcommand.Command {
 	cmd := c.Parser.AddCommand(name, shortDesc, longDesc, fn)
@@ -255,10 +284,59 @@ func flagsToStrings(flags []subcommand.Flag) []string {
 
 //Runs the client
 func (c *Cli) Run(args []string) error {
+	args, c.rawArgs = c.splitRawArgs(args)
 	_, err := c.Parser.Parse(args)
 	return err
 }
 
+//Splits the arguments after the params of the raw command, if that's the command called.
+//The flags of the raw command itself may come before or between its params
+func (c *Cli) splitRawArgs(args []string) (parsed, raw []string) {
+	for i := 0; i < len(args); i++ {
+		if strings.HasPrefix(args[i], "-") {
+			//skip the values of the global options
+			if flag, ok := findFlag(c.Flags(), args[i]); ok && flag.Type == subcommand.Option {
+				i++
+			}
+			continue
+		}
+		params, ok := c.rawParams[args[i]]
+		if !ok {
+			return args, nil
+		}
+		flags := c.Commands[args[i]].Flags()
+		j := i + 1
+		for j < len(args) {
+			if flag, ok := findFlag(flags, args[j]); ok {
+				if flag.Type == subcommand.Option {
+					j++
+				}
+				j++
+			} else if !strings.HasPrefix(args[j], "-") && params > 0 {
+				params--
+				j++
+			} else {
+				break
+			}
+		}
+		if j >= len(args) {
+			return args, nil
+		}
+		return args[:j], args[j:]
+	}
+	return args, nil
+}
+
+//Returns the flag matching the command line argument (--long or -short)
+func findFlag(flags []subcommand.Flag, arg string) (subcommand.Flag, bool) {
+	for _, flag := range flags {
+		if arg == "--"+flag.Long || (flag.Short != "" && arg == "-"+flag.Short) {
+			return flag, true
+		}
+	}
+	return subcommand.Flag{}, false
+}
+
 //Prints using the client output
 func (c *Cli) Printf(format string, vals ...interface{}) {
 	fmt.Fprintf(c.Output, format, vals...)
@@ -2,9 +2,11 @@ package cli
 
 import (
 	//"github.com/bertfrees/go-subcommand"
+	"errors"
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/daisy/pipeline-clientlib-go"
@@ -121,7 +123,7 @@ func TestCliNonRequiredOptions(t *testing.T) {
 	//parser.Parse([]string{"test","--source","value"})
 	err = cli.Run([]string{"test", "-o", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml"})
 	// FIXME: make this job pass
-	if !os.IsNotExist(err) {
+	if !errors.Is(err, os.ErrNotExist) {
 		t.Errorf("Unexpected pass %v", err)
 		if err != nil {
 			t.Errorf("Non required option threw an error %v", err.Error())
@@ -258,17 +260,27 @@ func TestConfigOptions(t *testing.T) {
 	}
 	link.pipeline.(*PipelineTest).withScripts = false
 	exp := Config{
-		HOST:         "http://google.com",
-		PORT:         80,
-		PATH:         "pipeline",
-		APPPATH:      "the_noose",
-		EXECLINE:     "",
-		CLIENTKEY:    "rounded",
-		CLIENTSECRET: "he_likes_justin_beiber",
-		TIMEOUT:      3,
-		DEBUG:        true,
-		STARTING:     true,
-		CONFPATH:     DEFAULT_FILE,
+		HOST:            "http://google.com",
+		PORT:            80,
+		PATH:            "pipeline",
+		APPPATH:         "the_noose",
+		EXECLINE:        "",
+		CLIENTKEY:       "rounded",
+		CLIENTSECRET:    "he_likes_justin_beiber",
+		TIMEOUT:         3,
+		DEBUG:           true,
+		STARTING:        true,
+		MAXRESULTSSIZE:  100,
+		MAXRESULTSFILES: 10,
+		JOBTIMEOUT:      "1h",
+		POLLRETRIES:     2,
+		POLLMIN:         "1s",
+		POLLMAX:         "1m",
+		IFEXISTS:        IF_EXISTS_RENAME,
+		ONSUCCESS:       "epubcheck out",
+		ONFAILURE:       "echo failed",
+		WEBHOOKSECRET:   "secret",
+		CONFPATH:        DEFAULT_FILE,
 	}
 
 	err = cli.Run([]string{"--" + HOST, exp[HOST].(string),
@@ -280,6 +292,16 @@ func TestConfigOptions(t *testing.T) {
 		"--" + TIMEOUT, strconv.Itoa(exp[TIMEOUT].(int)),
 		"--" + DEBUG, strconv.FormatBool(true),
 		"--" + STARTING, strconv.FormatBool(true),
+		"--" + MAXRESULTSSIZE, strconv.Itoa(exp[MAXRESULTSSIZE].(int)),
+		"--" + MAXRESULTSFILES, strconv.Itoa(exp[MAXRESULTSFILES].(int)),
+		"--" + JOBTIMEOUT, exp[JOBTIMEOUT].(string),
+		"--" + POLLRETRIES, strconv.Itoa(exp[POLLRETRIES].(int)),
+		"--" + POLLMIN, exp[POLLMIN].(string),
+		"--" + POLLMAX, exp[POLLMAX].(string),
+		"--" + IFEXISTS, exp[IFEXISTS].(string),
+		"--" + ONSUCCESS, exp[ONSUCCESS].(string),
+		"--" + ONFAILURE, exp[ONFAILURE].(string),
+		"--" + WEBHOOKSECRET, exp[WEBHOOKSECRET].(string),
 		"help",
 	})
 	if err != nil {
@@ -343,3 +365,26 @@ func TestConfigFile(t *testing.T) {
 	tCompareCnfs(res, EXP2, t)
 
 }
+
+func TestSplitRawArgs(t *testing.T) {
+	link := &PipelineLink{pipeline: newPipelineTest(false), config: config}
+	cli, err := makeCli("testprog", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cli.AddRawCommand("raw", "", 1, func(string, ...string) error { return nil }).
+		AddSwitch("own", "", "", func(string, string) error { return nil })
+	parsed, raw := cli.splitRawArgs([]string{"--host", "raw", "raw", "param", "--flag", "value"})
+	if strings.Join(parsed, " ") != "--host raw raw param" || strings.Join(raw, " ") != "--flag value" {
+		t.Errorf("Wrong split %v %v", parsed, raw)
+	}
+	parsed, raw = cli.splitRawArgs([]string{"raw", "param"})
+	if len(parsed) != 2 || raw != nil {
+		t.Errorf("Wrong split %v %v", parsed, raw)
+	}
+	//the flags of the raw command are parsed
+	parsed, raw = cli.splitRawArgs([]string{"raw", "--own", "--flag", "value"})
+	if strings.Join(parsed, " ") != "raw --own" || strings.Join(raw, " ") != "--flag value" {
+		t.Errorf("Wrong split %v %v", parsed, raw)
+	}
+}
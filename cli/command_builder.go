@@ -19,6 +19,7 @@ type commandBuilder struct {
 	desc     string //Command description
 	linkCall call   //function to call in order to execute the command
 	template string //Name of the template used to print the output
+	funcs    template.FuncMap //functions used by the template besides the common ones
 }
 
 //Creates a new commandBuilder
@@ -38,13 +39,19 @@ func (c *commandBuilder) withTemplate(template string) *commandBuilder {
 	return c
 }
 
+//Adds functions to be used by the template
+func (c *commandBuilder) withFuncs(funcs template.FuncMap) *commandBuilder {
+	c.funcs = funcs
+	return c
+}
+
 //builds the commands and adds it to the cli
 func (c *commandBuilder) build(cli *Cli) (cmd *subcommand.Command) {
 	return cli.AddCommand(c.name, c.desc, func(name string, args ...string) error {
 
 		data, err := c.linkCall(args...)
 		if err != nil {
-			return err
+			return linkError(err)
 		}
 		return c.writeOutput(data, cli)
 	})
@@ -56,18 +63,25 @@ func (c *commandBuilder) buildAdmin(cli *Cli) (cmd *subcommand.Command) {
 
 		data, err := c.linkCall(args...)
 		if err != nil {
-			return err
+			return linkError(err)
 		}
 		return c.writeOutput(data, cli)
 	})
 }
 
+//Writes the data using the template, or in the format chosen with --format
 func (c commandBuilder) writeOutput(data interface{}, cli *Cli) error {
+	if data != nil && cli.format != "" {
+		return writeFormatted(cli.Output, cli.format, data)
+	}
 	funcs := template.FuncMap{
 		"printAsPercentage": func(val float64) string {
 			return fmt.Sprintf("%.1f%%", val * 100)
 		},
 	}
+	for name, fn := range c.funcs {
+		funcs[name] = fn
+	}
 	tmpl := template.Must(template.New("template").Funcs(funcs).Parse(c.template))
 	if data != nil {
 		err := tmpl.Execute(cli.Output, data)
@@ -88,7 +102,7 @@ func (c *commandBuilder) buildWithId(cli *Cli) (cmd *subcommand.Command) {
 		}
 		data, err := c.linkCall(id)
 		if err != nil {
-			return err
+			return linkError(err)
 		}
 		return c.writeOutput(data, cli)
 	})
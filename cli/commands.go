@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/daisy/pipeline-clientlib-go"
 )
@@ -43,17 +45,26 @@ type printableJob struct {
 	Running bool
 }
 
+func (p *printableJob) wrapped() interface{} {
+	return p.Data
+}
+
 func AddJobStatusCommand(cli *Cli, link PipelineLink) {
 	printable := &printableJob{
 		Data:    pipeline.Job{},
 		Verbose: false,
 		Running: false,
 	}
+	events := ""
 	fn := func(args ...string) (interface{}, error) {
 		job, err := link.Job(args[0])
 		if err != nil {
 			return nil, err
 		}
+		if writer := newEventWriter(events, cli.Output, job.Id); writer != nil {
+			writer.job(job, printable.Verbose)
+			return nil, nil
+		}
 		printable.Data = job
 		if (job.Status == "RUNNING") {
 			printable.Running = true
@@ -68,6 +79,116 @@ func AddJobStatusCommand(cli *Cli, link PipelineLink) {
 		printable.Verbose = true
 		return nil
 	})
+	addEventsOption(cmd, &events)
+}
+
+func AddAttachCommand(cli *Cli, link PipelineLink) {
+	lastId := new(bool)
+	jExec := jobExecution{
+		link:    &link,
+		req:     newJobRequest(),
+		output:  "",
+		verbose: true,
+		zipped:  false,
+	}
+	cmd := cli.AddCommand("attach", "Follows the progress of a running job until it finishes", func(command string, args ...string) error {
+		id, err := checkId(*lastId, command, args...)
+		if err != nil {
+			return err
+		}
+		if jExec.jobTimeout, err = jExec.timeout(); err != nil {
+			return err
+		}
+		if jExec.output != "" {
+			if jExec.ifExists, err = ifExistsPolicy(jExec.ifExists, link.config); err != nil {
+				return err
+			}
+			if err = checkOutput(jExec.output, jExec.ifExists); err != nil {
+				return err
+			}
+		}
+		job, err := link.Job(id)
+		if err != nil {
+			return linkError(err)
+		}
+		messages := make(chan Message)
+		done := make(chan struct{})
+		go getAsyncMessages(link, id, messages, done)
+		status, err := jExec.follow(job, messages, done, cli.Output)
+		if err == errInterrupted {
+			return jExec.interrupted(job, cli.Output)
+		}
+		if state, ok := err.(jobTimedOut); ok {
+			return jExec.timedOut(job, state, cli.Output)
+		}
+		if err != nil {
+			return linkError(err)
+		}
+		output := ""
+		if jExec.output == "" {
+			jExec.say(cli.Output, "Job finished with status: %v\n", status)
+		} else if output, err = jExec.finish(job, status, cli.Output); err != nil {
+			return linkError(err)
+		}
+		var errs errorList
+		errs.add(jobStatusError(id, status))
+		errs.add(jExec.runHooks(job, status, output, cli.Output))
+		return errs.err()
+	})
+	addLastId(cmd, lastId)
+	cmd.AddOption("output", "o", "Path where to store the results once the job is finished. If not given the results are not retrieved", "", "DIRECTORY", func(name, folder string) error {
+		jExec.output = folder
+		return nil
+	})
+	cmd.AddSwitch("zip", "z", "Write the output to a zip file rather than to a folder", func(string, string) error {
+		jExec.zipped = true
+		return nil
+	})
+	addResultSelectionOptions(cmd, &jExec.selection)
+	addJobFilesOptions(cmd, &jExec.files)
+	addIfExistsOption(cmd, &jExec.ifExists)
+	addHooksOptions(cmd, &jExec.hooks)
+	cmd.AddSwitch("quiet", "q", "Do not print the job's messages", func(string, string) error {
+		jExec.verbose = false
+		return nil
+	})
+	cmd.AddSwitch("persistent", "p", "Do not delete the job after its results are stored", func(string, string) error {
+		jExec.persistent = true
+		return nil
+	})
+	addOnInterruptOption(cmd, &jExec.onInterrupt)
+	addJobTimeoutOption(cmd, &jExec.jobTimeout)
+	addProgressOption(cmd, &jExec.progress)
+	addEventsOption(cmd, &jExec.events)
+}
+
+func AddSubmitCommand(cli *Cli, link PipelineLink) {
+	dataPath := ""
+	cmd := cli.AddCommand("submit", "Sends a job request saved with --save-request and exits", func(command string, args ...string) error {
+		req, err := loadJobRequest(args[0])
+		if err != nil {
+			return ValidationError{err}
+		}
+		data := JobRequest{DataPath: dataPath}
+		if err := data.loadData(); err != nil {
+			return ValidationError{err}
+		}
+		defer data.closeData()
+		job, err := link.Submit(req, data.Data)
+		if err != nil {
+			return err
+		}
+		cli.Printf("Job %v sent to the server\n", job.Id)
+		return storeLastId(job.Id)
+	})
+	cmd.SetArity(1, "FILE")
+	cmd.AddOption("data", "d", "Zip file or directory containing the files the request refers to", "", "ZIP", func(name, path string) error {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+		dataPath = path
+		return nil
+	})
 }
 
 func AddDeleteCommand(cli *Cli, link PipelineLink) {
@@ -86,18 +207,35 @@ func AddDeleteCommand(cli *Cli, link PipelineLink) {
 func AddResultsCommand(cli *Cli, link PipelineLink) {
 	outputPath := ""
 	zipped := false
+	progress := ""
+	list := false
+	selection := resultSelection{}
+	files := jobFiles{}
+	ifExists := ""
 	cmd := newCommandBuilder("results", "Stores the results from a job").
 		withCall(func(args ...string) (v interface{}, err error) {
 
-		wc, err := zipProcessor(outputPath, zipped)
+		if list {
+			job, err := link.Job(args[0])
+			if err != nil {
+				return nil, err
+			}
+			ports := selection.filter(resultPorts(job))
+			return nil, newCommandBuilder("results", "").withTemplate(ResultPortsTemplate).writeOutput(ports, cli)
+		}
+		if outputPath == "" {
+			return nil, ValidationError{errors.New("--output option is mandatory unless the results are listed")}
+		}
+		policy, err := ifExistsPolicy(ifExists, link.config)
 		if err != nil {
 			return
 		}
-		ok, err := link.Results(args[0], wc)
+		//the progress goes to stderr so the output can still be parsed
+		ok, stored, err := storeResults(link, args[0], outputPath, zipped, selection, policy, newProgressRenderer(progress, os.Stderr))
 		if err != nil {
 			return
 		}
-		if err = wc.Close(); err != nil {
+		if err = files.store(link, args[0], stored, zipped, time.Time{}, time.Time{}); err != nil {
 			return
 		}
 
@@ -106,7 +244,7 @@ func AddResultsCommand(cli *Cli, link PipelineLink) {
 			extra = "zipfile "
 		}
 		if ok {
-			return fmt.Sprintf("Results stored into %s%v\n", extra, outputPath), err
+			return fmt.Sprintf("Results stored into %s%v\n", extra, stored), err
 		} else {
 			return fmt.Sprintf("No results available for job %s\n", args[0]), err
 		}
@@ -114,12 +252,20 @@ func AddResultsCommand(cli *Cli, link PipelineLink) {
 	cmd.AddOption("output", "o", "Directory where to store the results", "", "DIRECTORY", func(name, folder string) error {
 		outputPath = folder
 		return nil
-	}).Must(true)
+	}).Must(false)
 
 	cmd.AddSwitch("zipped", "z", "Store the results into a zipfile rather than to folder", func(string, string) error {
 		zipped = true
 		return nil
 	}).Must(false)
+	cmd.AddSwitch("list", "", "List the output ports and their files instead of storing them", func(string, string) error {
+		list = true
+		return nil
+	})
+	addResultSelectionOptions(cmd, &selection)
+	addJobFilesOptions(cmd, &files)
+	addIfExistsOption(cmd, &ifExists)
+	addProgressOption(cmd, &progress)
 }
 
 func AddLogCommand(cli *Cli, link PipelineLink) {
@@ -169,10 +315,17 @@ func AddHaltCommand(cli *Cli, link PipelineLink) {
 }
 
 func AddJobsCommand(cli *Cli, link PipelineLink) {
-	newCommandBuilder("jobs", "Returns the list of jobs present in the server").
-		withCall(func(...string) (interface{}, error) {
-		return link.Jobs()
+	query := jobQuery{}
+	builder := newCommandBuilder("jobs", "Returns the list of jobs present in the server")
+	cmd := builder.withCall(func(...string) (interface{}, error) {
+		jobs, err := link.Jobs()
+		if err != nil {
+			return nil, err
+		}
+		builder.withTemplate(query.template())
+		return query.apply(jobs), nil
 	}).withTemplate(JobListTemplate).build(cli)
+	addJobQueryOptions(cmd, &query)
 }
 
 func AddQueueCommand(cli *Cli, link PipelineLink) {
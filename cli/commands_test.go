@@ -640,3 +640,140 @@ func TestCleanErrors(t *testing.T) {
 		t.Errorf("The message is not correct '%s'!='%s'", expected, result)
 	}
 }
+
+//Checks that attach follows the job until it finishes
+func TestAttachCommand(t *testing.T) {
+	cli, link, pipe := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddAttachCommand(cli, link)
+	err := cli.Run([]string{"attach", "id"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if pipe.count < 2 {
+		t.Errorf("The job wasn't followed")
+	}
+	if pipe.deleted {
+		t.Errorf("The job was deleted without storing its results")
+	}
+	if !strings.Contains(r.String(), "Job finished with status: SUCCESS") {
+		t.Errorf("Final status not printed:\n%s", r.String())
+	}
+}
+
+//Checks that attach stores the results and deletes the job when an output is given
+func TestAttachCommandOutput(t *testing.T) {
+	data := createZipFile(t)
+	cli, link, pipe := makeReturningCli(data, t)
+	deleted := false
+	pipe.delete = func(id string) (bool, error) {
+		deleted = true
+		return true, nil
+	}
+	overrideOutput(cli)
+	AddAttachCommand(cli, link)
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	err = cli.Run([]string{"attach", "-o", dir, "id"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "readme.txt")); err != nil {
+		t.Errorf("Results weren't stored")
+	}
+	if !deleted {
+		t.Errorf("The job wasn't deleted")
+	}
+}
+
+//Checks that interrupting attach applies the on-interrupt policy like run does
+func TestAttachCommandInterrupt(t *testing.T) {
+	defer mockInterrupt()()
+	defer func(path string) { LastIdPath = path }(LastIdPath)
+	LastIdPath = filepath.Join(os.TempDir(), "testLastId")
+	defer os.Remove(LastIdPath)
+	for policy, expected := range map[string]bool{INTERRUPT_DELETE: true, INTERRUPT_KEEP: false} {
+		cli, link, pipe := makeReturningCli(nil, t)
+		deleted := false
+		pipe.delete = func(id string) (bool, error) {
+			deleted = true
+			return true, nil
+		}
+		overrideOutput(cli)
+		AddAttachCommand(cli, link)
+		if err := cli.Run([]string{"attach", "--on-interrupt", policy, "id"}); err == nil {
+			t.Errorf("Interrupted attach didn't error")
+		}
+		if deleted != expected {
+			t.Errorf("With --on-interrupt %v the job was deleted: %v", policy, deleted)
+		}
+	}
+}
+
+//Checks that the error is propagated when the job can't be retrieved
+func TestAttachCommandError(t *testing.T) {
+	cli, link, p := makeReturningCli(nil, t)
+	p.failOnCall = JOB_CALL
+	overrideOutput(cli)
+	AddAttachCommand(cli, link)
+	err := cli.Run([]string{"attach", "id"})
+	if err == nil {
+		t.Errorf("Expected error not propagated")
+	}
+}
+
+//A request saved by a script command is sent as it is, but to the script of the current webservice
+func TestSubmitCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { LastIdPath = path }(LastIdPath)
+	LastIdPath = filepath.Join(dir, "lastid")
+	source := filepath.Join(dir, "source.xml")
+	if err := ioutil.WriteFile(source, []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	request := filepath.Join(dir, "request.xml")
+	pipe := newPipelineTest(false)
+	link := PipelineLink{FsAllow: true, pipeline: pipe}
+	cli, err := makeCli("test", &link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := scriptToCommand(SCRIPT, cli, &link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err = cli.Run([]string{"test", "-o", dir, "--source", source, "--single", source, "--test-opt", source,
+		"--another-opt", "bar", "--nicename", "saved", "--save-request", request, "--dry-run"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	//the script commands can only be run once
+	if cli, err = makeCli("test", &link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddSubmitCommand(cli, link)
+	if err := cli.Run([]string{"submit", request}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	sent := pipe.jobRequest
+	if sent.Script.Href != SCRIPT.Id || sent.Nicename != "saved" {
+		t.Errorf("Wrong request sent %+v", sent)
+	}
+	if len(sent.Inputs) != 2 || len(sent.Options) != 2 {
+		t.Errorf("Inputs and options not sent %+v", sent)
+	}
+	for _, option := range sent.Options {
+		if option.Name == "another-opt" && option.Value != "bar" {
+			t.Errorf("Wrong option value %v", option.Value)
+		}
+	}
+	if err := cli.Run([]string{"submit", source}); err == nil {
+		t.Errorf("Invalid request didn't error")
+	}
+}
@@ -11,7 +11,9 @@ import (
 	"path/filepath"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kardianos/osext"
 	"launchpad.net/goyaml"
@@ -19,17 +21,27 @@ import (
 
 //Yaml file keys
 const (
-	HOST         = "host"
-	PORT         = "port"
-	PATH         = "ws_path"
-	APPPATH      = "app_path"
-	EXECLINE     = "exec_line" // hidden feature
-	CLIENTKEY    = "client_key"
-	CLIENTSECRET = "client_secret"
-	TIMEOUT      = "timeout"
-	DEBUG        = "debug"
-	STARTING     = "starting"
-	CONFPATH     = "conf_path"
+	HOST            = "host"
+	PORT            = "port"
+	PATH            = "ws_path"
+	APPPATH         = "app_path"
+	EXECLINE        = "exec_line" // hidden feature
+	CLIENTKEY       = "client_key"
+	CLIENTSECRET    = "client_secret"
+	TIMEOUT         = "timeout"
+	DEBUG           = "debug"
+	STARTING        = "starting"
+	CONFPATH        = "conf_path"
+	MAXRESULTSSIZE  = "max_results_size"
+	MAXRESULTSFILES = "max_results_files"
+	JOBTIMEOUT      = "job_timeout"
+	POLLRETRIES     = "poll_retries"
+	POLLMIN         = "poll_min_interval"
+	POLLMAX         = "poll_max_interval"
+	IFEXISTS        = "if_exists"
+	ONSUCCESS       = "on_success"
+	ONFAILURE       = "on_failure"
+	WEBHOOKSECRET   = "webhook_secret"
 )
 
 //Other convinience constants
@@ -46,31 +58,51 @@ type Config map[string]interface{}
 //Default minimal configuration
 var config = Config{
 
-	HOST:         "http://localhost",
-	PORT:         8181,
-	PATH:         "ws",
-	APPPATH:      "",
-	EXECLINE:     "",
-	CLIENTKEY:    "",
-	CLIENTSECRET: "",
-	TIMEOUT:      10,
-	DEBUG:        false,
-	STARTING:     false,
-	CONFPATH:     DEFAULT_FILE, // path to the config file, for path resolution (not exposed through config_descriptions)
+	HOST:            "http://localhost",
+	PORT:            8181,
+	PATH:            "ws",
+	APPPATH:         "",
+	EXECLINE:        "",
+	CLIENTKEY:       "",
+	CLIENTSECRET:    "",
+	TIMEOUT:         10,
+	DEBUG:           false,
+	STARTING:        false,
+	MAXRESULTSSIZE:  10240,
+	MAXRESULTSFILES: 100000,
+	JOBTIMEOUT:      "",
+	POLLRETRIES:     5,
+	POLLMIN:         "500ms",
+	POLLMAX:         "10s",
+	IFEXISTS:        IF_EXISTS_MERGE,
+	ONSUCCESS:       "",
+	ONFAILURE:       "",
+	WEBHOOKSECRET:   "",
+	CONFPATH:        DEFAULT_FILE, // path to the config file, for path resolution (not exposed through config_descriptions)
 }
 
 //Config items descriptions
 var config_descriptions = map[string]string{
 
-	HOST:         "Host part of webservice address. Leave empty if you wish to use the app_path setting",
-	PORT:         "Port part of webservice address. Leave empty if you wish to use the app_path setting",
-	PATH:         "Path part of webservice address, as in HOST:PORT/PATH (e.g. http://localhost:8181/ws). Leave empty if you wish to use the app_path setting",
-	APPPATH:      "Path to the DAISY Pipeline app. If left empty, the PATH is searched for a \"DAISY Pipeline\" executable",
-	CLIENTKEY:    "Client key for authenticated requests",
-	CLIENTSECRET: "Client secret for authenticated requests",
-	TIMEOUT:      "Timeout for requests to the webservice in seconds",
-	DEBUG:        "Print debug messages",
-	STARTING:     "Start the DAISY Pipeline app if it is not running",
+	HOST:            "Host part of webservice address. Leave empty if you wish to use the app_path setting",
+	PORT:            "Port part of webservice address. Leave empty if you wish to use the app_path setting",
+	PATH:            "Path part of webservice address, as in HOST:PORT/PATH (e.g. http://localhost:8181/ws). Leave empty if you wish to use the app_path setting",
+	APPPATH:         "Path to the DAISY Pipeline app. If left empty, the PATH is searched for a \"DAISY Pipeline\" executable",
+	CLIENTKEY:       "Client key for authenticated requests",
+	CLIENTSECRET:    "Client secret for authenticated requests",
+	TIMEOUT:         "Timeout for requests to the webservice in seconds",
+	DEBUG:           "Print debug messages",
+	STARTING:        "Start the DAISY Pipeline app if it is not running",
+	MAXRESULTSSIZE:  "Maximum size in MB of the extracted results, 0 for no limit",
+	MAXRESULTSFILES: "Maximum number of files in the extracted results, 0 for no limit",
+	JOBTIMEOUT:      "Time after which a job run in the foreground is no longer followed, e.g. 90s, 30m or 2h. Empty for no limit",
+	POLLRETRIES:     "Number of times checking a job is retried after an error before giving up, waiting longer each time",
+	POLLMIN:         "Time between two checks of a job while it is active, also the minimum time between any two checks when following several jobs",
+	POLLMAX:         "Maximum time between two checks of a job, reached while it shows no activity",
+	IFEXISTS:        "What to do when the output of a job already exists: fail, overwrite, merge (write into the existing folder) or rename (add a numeric suffix)",
+	ONSUCCESS:       "Command run after a job run in the foreground succeeds and its results are stored, see --on-success",
+	ONFAILURE:       "Command run after a job run in the foreground fails, see --on-failure",
+	WEBHOOKSECRET:   "Secret used to sign the notifications posted by the notify command",
 }
 
 
@@ -242,6 +274,29 @@ func (c Config) Url() string {
 	return testUrl
 }
 
+//Returns the integer value of the key or its default if not set
+func (c Config) intValue(key string) int {
+	if value, ok := c[key].(int); ok {
+		return value
+	}
+	return config[key].(int)
+}
+
+//Returns the duration value of the key, given either as a duration (e.g. 30m) or as a number
+//of seconds. Zero if not set
+func (c Config) durationValue(key string) (time.Duration, error) {
+	switch value := c[key].(type) {
+	case int:
+		return parseDuration(strconv.Itoa(value))
+	case string:
+		if value == "" {
+			return 0, nil
+		}
+		return parseDuration(value)
+	}
+	return 0, nil
+}
+
 func (c Config) AppPath() string {
 	var base = ""
 	err := error(nil)
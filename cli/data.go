@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+//File in the data directory listing the patterns to leave out of the zip
+const DATA_IGNORE_FILE = ".dp2ignore"
+
+//Opens the data of the request so it can be streamed to the server. Zip files are read
+//from disk as they are sent and directories are zipped on the fly. The entries of the
+//zip are kept to check the paths given to the script
+func (r *JobRequest) loadData() (err error) {
+	if r.Data != nil || r.DataPath == "" {
+		return nil
+	}
+	info, err := os.Stat(r.DataPath)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		zr, err := zip.OpenReader(r.DataPath)
+		if err != nil {
+			return fmt.Errorf("%v is not a valid zip file: %v", r.DataPath, err)
+		}
+		r.dataEntries = make([]string, len(zr.File))
+		for idx, f := range zr.File {
+			r.dataEntries[idx] = f.Name
+		}
+		zr.Close()
+		r.Data, err = os.Open(r.DataPath)
+		return err
+	}
+	patterns, err := readIgnoreFile(r.DataPath)
+	if err != nil {
+		return
+	}
+	if r.dataEntries, err = listDataFiles(r.DataPath, append(patterns, r.DataExcludes...)); err != nil {
+		return
+	}
+	reader, writer := io.Pipe()
+	go func(dir string, files []string) {
+		writer.CloseWithError(zipFiles(writer, dir, files))
+	}(r.DataPath, r.dataEntries)
+	r.Data = reader
+	return
+}
+
+//Releases the data of the request once it has been sent
+func (r *JobRequest) closeData() {
+	if closer, ok := r.Data.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+//Reads the exclude patterns from the ignore file in dir, one per line.
+//Empty lines and lines starting with # are skipped
+func readIgnoreFile(dir string) (patterns []string, err error) {
+	file, err := os.Open(filepath.Join(dir, DATA_IGNORE_FILE))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+//Checks if the path (relative to the data directory and slash separated) matches
+//any of the patterns. Patterns containing a slash are matched against the whole path,
+//the rest against the file name. Patterns ending with a slash only match directories
+func isExcluded(rel string, isDir bool, patterns []string) bool {
+	for _, pattern := range patterns {
+		if strings.HasSuffix(pattern, "/") {
+			if !isDir {
+				continue
+			}
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		target := path.Base(rel)
+		if strings.Contains(pattern, "/") {
+			target = rel
+			pattern = strings.TrimPrefix(pattern, "/")
+		}
+		if match, _ := path.Match(pattern, target); match {
+			return true
+		}
+	}
+	return false
+}
+
+//Lists the files in dir (relative and slash separated) leaving out the ignore file
+//and the entries matching the patterns
+func listDataFiles(dir string, patterns []string) (files []string, err error) {
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == DATA_IGNORE_FILE || isExcluded(rel, info.IsDir(), patterns) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return
+}
+
+//Writes a zip containing the given files of dir
+func zipFiles(w io.Writer, dir string, files []string) error {
+	zw := zip.NewWriter(w)
+	for _, name := range files {
+		if err := zipFile(zw, filepath.Join(dir, filepath.FromSlash(name)), name); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func zipFile(zw *zip.Writer, file, name string) error {
+	src, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+//Checks that the file or directory is present in the data sent with the request.
+//Nothing is checked if the data hasn't been opened yet
+func (r *JobRequest) checkInData(file string) error {
+	if r.dataEntries == nil {
+		return nil
+	}
+	name := strings.TrimPrefix(path.Clean(toSlash(file)), "/")
+	for _, entry := range r.dataEntries {
+		entry = strings.TrimSuffix(entry, "/")
+		if entry == name || strings.HasPrefix(entry, name+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%v not found in the data zip", file)
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestIsExcluded(t *testing.T) {
+	patterns := []string{"*.bak", "build/", "/images/*.png"}
+	tests := []struct {
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		{"book.xml", false, false},
+		{"book.xml.bak", false, true},
+		{"sub/old.bak", false, true},
+		{"build", true, true},
+		{"build", false, false},
+		{"images/cover.png", false, true},
+		{"sub/images/cover.png", false, false},
+	}
+	for _, test := range tests {
+		if res := isExcluded(test.path, test.isDir, patterns); res != test.excluded {
+			t.Errorf("Excluding %v: expected %v got %v", test.path, test.excluded, res)
+		}
+	}
+}
+
+func TestLoadDataDirectory(t *testing.T) {
+	dir := makeDataDir(t)
+	files := map[string]string{
+		DATA_IGNORE_FILE:  "# comment\n\n*.bak\n",
+		"tmp/old.bak":     "",
+		"build/out.xml":   "",
+		"images/logo.png": "",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := newJobRequest()
+	req.DataPath = dir
+	req.DataExcludes = []string{"build/"}
+	if err := req.loadData(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer req.closeData()
+	data, err := ioutil.ReadAll(req.Data)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	expected := []string{"images/logo.png", "myfile.xml", "tmp/file", "tmp/file2"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected entries %v got %v", expected, names)
+	}
+	for idx, name := range expected {
+		if names[idx] != name {
+			t.Errorf("Expected entry %v got %v", name, names[idx])
+		}
+	}
+}
+
+func TestCheckInData(t *testing.T) {
+	dir := makeDataDir(t)
+	zipPath := filepath.Join(dir, "data.zip")
+	files, err := listDataFiles(dir, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	file, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = zipFiles(file, dir, files)
+	file.Close()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	req := newJobRequest()
+	req.DataPath = zipPath
+	if err := req.loadData(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	req.closeData()
+	for _, path := range []string{"myfile.xml", "./tmp/file", "tmp", "tmp/"} {
+		if err := req.checkInData(path); err != nil {
+			t.Errorf("Unexpected error for %v: %v", path, err)
+		}
+	}
+	for _, path := range []string{"missing.xml", "tmp/fil", "file"} {
+		if err := req.checkInData(path); err == nil {
+			t.Errorf("Expected error for %v", path)
+		}
+	}
+	if err := ioutil.WriteFile(zipPath, []byte("i'm not a zip file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	req = newJobRequest()
+	req.DataPath = zipPath
+	if err := req.loadData(); err == nil {
+		t.Errorf("Expected error for invalid zip")
+	}
+}
+
+func TestScriptDataMissingFile(t *testing.T) {
+	config := copyConf()
+	config[STARTING] = false
+	pipeline := newPipelineTest(false)
+	pipeline.fsallow = false
+	link := &PipelineLink{pipeline: pipeline, config: config}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Error("Unexpected error")
+	}
+	if _, err = scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Error("Unexpected error")
+	}
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", makeDataDir(t), "--data-exclude", "tmp/", "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml"})
+	if err == nil {
+		t.Errorf("Input excluded from the data didn't error")
+	}
+}
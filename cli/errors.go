@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Returned when a job finished with a status other than SUCCESS
+type JobStatusError struct {
+	Id     string
+	Status string
+}
+
+func (e JobStatusError) Error() string {
+	return fmt.Sprintf("Job %v finished with status %v", e.Id, e.Status)
+}
+
+//Returned when the job request or the command's arguments are not valid
+type ValidationError struct {
+	Err error
+}
+
+func (e ValidationError) Error() string { return e.Err.Error() }
+func (e ValidationError) Unwrap() error { return e.Err }
+
+//Returned when the webservice can't be reached
+type ConnectionError struct {
+	Err error
+}
+
+func (e ConnectionError) Error() string { return e.Err.Error() }
+func (e ConnectionError) Unwrap() error { return e.Err }
+
+//Returned when the webservice rejects the client credentials or they are missing
+type AuthError struct {
+	Err error
+}
+
+func (e AuthError) Error() string { return e.Err.Error() }
+func (e AuthError) Unwrap() error { return e.Err }
+
+//Returned when the webservice took too long to answer
+type TimeoutError struct {
+	Err error
+}
+
+func (e TimeoutError) Error() string { return e.Err.Error() }
+func (e TimeoutError) Unwrap() error { return e.Err }
+
+//Returned when the job followed by dp2 doesn't finish within the job timeout
+type JobTimeoutError struct {
+	JobId   string
+	Timeout time.Duration
+}
+
+func (e JobTimeoutError) Error() string {
+	return fmt.Sprintf("Job %v didn't finish within %v", e.JobId, e.Timeout)
+}
+
+//Returned when a hook run after the job couldn't be run or exited with an error
+type HookError struct {
+	Command string
+	Code    int //exit code of the hook, -1 if it couldn't be run
+	Err     error
+}
+
+func (e HookError) Error() string {
+	if e.Code >= 0 {
+		return fmt.Sprintf("Hook %q exited with code %v", e.Command, e.Code)
+	}
+	return fmt.Sprintf("Hook %q could not be run: %v", e.Command, e.Err)
+}
+func (e HookError) Unwrap() error { return e.Err }
+
+//Several errors reported at once, one per line
+type errorList []error
+
+func (l errorList) Error() string {
+	lines := make([]string, len(l))
+	for idx, err := range l {
+		lines[idx] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+//Matches if any of the errors does, so errors.Is and errors.As see through the list
+func (l errorList) Is(target error) bool {
+	for _, err := range l {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l errorList) As(target interface{}) bool {
+	for _, err := range l {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+//Adds the error, the errors of another list are added one by one
+func (l *errorList) add(err error) {
+	if list, ok := err.(errorList); ok {
+		*l = append(*l, list...)
+	} else if err != nil {
+		*l = append(*l, err)
+	}
+}
+
+//Returns nil if the list is empty and the error itself if there's only one
+func (l errorList) err() error {
+	switch len(l) {
+	case 0:
+		return nil
+	case 1:
+		return l[0]
+	}
+	return l
+}
+
+//Returns the error for a job that finished with the given status, nil if it succeeded
+func jobStatusError(id, status string) error {
+	if status == "FAIL" || status == "ERROR" {
+		return JobStatusError{Id: id, Status: status}
+	}
+	return nil
+}
+
+//Gives a type to the errors returned by the calls to the webservice so the cause can be
+//told apart. Errors which are already typed or have an unknown cause are returned as they are
+func linkError(err error) error {
+	var validationErr ValidationError
+	var connectionErr ConnectionError
+	var authErr AuthError
+	var timeoutErr TimeoutError
+	if err == nil ||
+		errors.As(err, &validationErr) ||
+		errors.As(err, &connectionErr) ||
+		errors.As(err, &authErr) ||
+		errors.As(err, &timeoutErr) {
+		return err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return TimeoutError{err}
+		}
+		return ConnectionError{err}
+	}
+	if err.Error() == pipeline.ERR_401 {
+		return AuthError{err}
+	}
+	return err
+}
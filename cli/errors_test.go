@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func TestLinkError(t *testing.T) {
+	refused := &url.Error{Op: "Get", URL: "http://localhost:8181/ws/alive", Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	timeout := &url.Error{Op: "Get", URL: "http://localhost:8181/ws/alive", Err: os.ErrDeadlineExceeded}
+	var connectionErr ConnectionError
+	if err := linkError(refused); !errors.As(err, &connectionErr) {
+		t.Errorf("Expected a connection error got %#v", err)
+	}
+	var timeoutErr TimeoutError
+	if err := linkError(timeout); !errors.As(err, &timeoutErr) {
+		t.Errorf("Expected a timeout error got %#v", err)
+	}
+	var authErr AuthError
+	if err := linkError(errors.New(pipeline.ERR_401)); !errors.As(err, &authErr) {
+		t.Errorf("Expected an auth error got %#v", err)
+	}
+	validation := ValidationError{refused}
+	if err := linkError(validation); err != validation {
+		t.Errorf("Typed error was changed %#v", err)
+	}
+	other := errors.New("something else")
+	if err := linkError(other); err != other {
+		t.Errorf("Unknown error was changed %#v", err)
+	}
+	if linkError(nil) != nil {
+		t.Errorf("nil became an error")
+	}
+}
+
+func TestJobStatusError(t *testing.T) {
+	if err := jobStatusError("job1", "SUCCESS"); err != nil {
+		t.Errorf("Unexpected error for a successful job %v", err)
+	}
+	for _, status := range []string{"FAIL", "ERROR"} {
+		var jobErr JobStatusError
+		if err := jobStatusError("job1", status); !errors.As(err, &jobErr) || jobErr.Status != status {
+			t.Errorf("Expected a job status error for %v got %#v", status, err)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	var errs errorList
+	if errs.err() != nil {
+		t.Errorf("Empty list isn't nil")
+	}
+	errs.add(nil)
+	errs.add(os.ErrNotExist)
+	if errs.err() != os.ErrNotExist {
+		t.Errorf("Single error isn't returned as it is %v", errs.err())
+	}
+	errs.add(errorList{ValidationError{errors.New("invalid")}, errors.New("other")})
+	if len(errs) != 3 || errs.Error() != os.ErrNotExist.Error()+"\ninvalid\nother" {
+		t.Errorf("Wrong list %q", errs.Error())
+	}
+	var validationErr ValidationError
+	if !errors.Is(errs.err(), os.ErrNotExist) || !errors.As(errs.err(), &validationErr) {
+		t.Errorf("The errors in the list aren't matched")
+	}
+}
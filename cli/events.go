@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bertfrees/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Formats of the event stream
+const (
+	EVENTS_JSON = "json" //newline-delimited JSON
+)
+
+//Event types
+const (
+	EVENT_SUBMITTED = "submitted"
+	EVENT_MESSAGE   = "message"
+	EVENT_PROGRESS  = "progress"
+	EVENT_STATUS    = "status"
+	EVENT_RESULTS   = "results-downloaded"
+	EVENT_TIMEOUT   = "timeout"
+)
+
+//Fields of an event, the event type, time and job id are added when written
+type jobEvent map[string]interface{}
+
+//Writes the events of a job as newline-delimited JSON, events are written instead
+//of the human readable output so other tools can follow the job
+type eventWriter struct {
+	out      io.Writer
+	jobId    string
+	progress float64 //last progress written
+	status   string  //last status written
+}
+
+//Adds the option to choose the format of the event stream
+func addEventsOption(cmd *subcommand.Command, format *string) {
+	cmd.AddOption("events", "", "Print the job's events in the given format instead of the human readable output (json)", "", "FORMAT", func(name, value string) error {
+		if value != EVENTS_JSON {
+			return ValidationError{fmt.Errorf("%s is not a valid value for --%s. Allowed values are %s", value, name, EVENTS_JSON)}
+		}
+		*format = value
+		return nil
+	})
+}
+
+//Returns an event writer for the job or nil if no events were asked for
+func newEventWriter(format string, out io.Writer, jobId string) *eventWriter {
+	if format != EVENTS_JSON {
+		return nil
+	}
+	return &eventWriter{out: out, jobId: jobId}
+}
+
+//Writes the event as a single line
+func (e *eventWriter) emit(event string, fields jobEvent) error {
+	line := jobEvent{}
+	for key, value := range fields {
+		line[key] = value
+	}
+	line["event"] = event
+	line["time"] = time.Now().UTC().Format(time.RFC3339)
+	if e.jobId != "" {
+		line["job"] = e.jobId
+	}
+	bytes, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.out, "%s\n", bytes)
+	return err
+}
+
+//Writes the events derived from a message fed by getAsyncMessages: the message itself
+//(unless quiet), and the progress and status when they change
+func (e *eventWriter) message(msg Message, verbose bool) {
+	if verbose && msg.Message != "" {
+		e.emit(EVENT_MESSAGE, jobEvent{
+			"level":    msg.Level,
+			"depth":    msg.Depth,
+			"sequence": msg.Sequence,
+			"text":     msg.Message,
+		})
+	}
+	if msg.Progress > e.progress {
+		e.progress = msg.Progress
+		e.emit(EVENT_PROGRESS, jobEvent{"progress": msg.Progress})
+	}
+	if msg.Status != "" && msg.Status != e.status {
+		e.status = msg.Status
+		e.emit(EVENT_STATUS, jobEvent{"status": msg.Status})
+	}
+}
+
+//Writes the events describing the current state of the job
+func (e *eventWriter) job(job pipeline.Job, verbose bool) {
+	messages := make(chan Message)
+	go func() {
+		flattenMessages(job.Messages.Message, messages, job.Status, job.Messages.Progress, 0, 0)
+		close(messages)
+	}()
+	for msg := range messages {
+		e.message(msg, verbose)
+	}
+	e.message(Message{Status: job.Status, Progress: job.Messages.Progress}, false)
+}
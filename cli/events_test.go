@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+//Decodes the lines written by the event writer
+func readEvents(t *testing.T, r *bytes.Buffer) []jobEvent {
+	events := []jobEvent{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		event := jobEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid event %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEventWriterMessage(t *testing.T) {
+	r := new(bytes.Buffer)
+	writer := newEventWriter(EVENTS_JSON, r, "job1")
+	writer.message(Message{Message: "hello", Level: "INFO", Sequence: 1, Status: "RUNNING", Progress: .5}, true)
+	writer.message(Message{Message: "quiet", Level: "INFO", Sequence: 2, Status: "RUNNING", Progress: .5}, false)
+	writer.message(Message{Status: "SUCCESS", Progress: 1}, true)
+	events := readEvents(t, r)
+	expected := []string{EVENT_MESSAGE, EVENT_PROGRESS, EVENT_STATUS, EVENT_PROGRESS, EVENT_STATUS}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %v events got %v", len(expected), events)
+	}
+	for idx, event := range expected {
+		if events[idx]["event"] != event {
+			t.Errorf("Expected event %v got %v", event, events[idx]["event"])
+		}
+		if events[idx]["job"] != "job1" {
+			t.Errorf("Wrong job id %v", events[idx]["job"])
+		}
+		if _, ok := events[idx]["time"]; !ok {
+			t.Errorf("Event without time")
+		}
+	}
+	if events[0]["text"] != "hello" {
+		t.Errorf("Wrong message text %v", events[0]["text"])
+	}
+	if events[4]["status"] != "SUCCESS" {
+		t.Errorf("Wrong status %v", events[4]["status"])
+	}
+}
+
+func TestEventWriterNone(t *testing.T) {
+	if newEventWriter("", new(bytes.Buffer), "job1") != nil {
+		t.Errorf("Event writer created without format")
+	}
+}
+
+func TestJobStatusCommandEvents(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddJobStatusCommand(cli, link)
+	err := cli.Run([]string{"status", "--events", "json", "id"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	events := readEvents(t, r)
+	if len(events) == 0 {
+		t.Fatalf("No events written")
+	}
+	last := events[len(events)-1]
+	if last["event"] != EVENT_STATUS || last["status"] != JOB_1.Status {
+		t.Errorf("Expected last event to be the status %v got %v", JOB_1.Status, last)
+	}
+}
+
+func TestJobStatusCommandEventsInvalid(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	overrideOutput(cli)
+	AddJobStatusCommand(cli, link)
+	if err := cli.Run([]string{"status", "--events", "xml", "id"}); err == nil {
+		t.Errorf("Invalid events format didn't error")
+	}
+}
+
+func TestScriptEventsWarnings(t *testing.T) {
+	LastIdPath = os.TempDir() + string(os.PathSeparator) + "testLastId"
+	defer os.Remove(LastIdPath)
+	link := &PipelineLink{FsAllow: true, pipeline: newPipelineTest(false)}
+	jExec := newJobExecution(link, "test")
+	jExec.output = os.TempDir()
+	jExec.req.Background = true
+	jExec.events = EVENTS_JSON
+	r := new(bytes.Buffer)
+	if err := jExec.run(r); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	//every line is an event
+	if events := readEvents(t, r); len(events) != 1 || events[0]["event"] != EVENT_SUBMITTED {
+		t.Errorf("Wrong events %v", events)
+	}
+	//the warning is printed with the human readable output otherwise
+	jExec.events = ""
+	r.Reset()
+	if err := jExec.run(r); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !strings.Contains(r.String(), "Warning: --output option ignored") {
+		t.Errorf("Warning not printed %q", r.String())
+	}
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"launchpad.net/goyaml"
+)
+
+//Formats the commands can print their data in instead of their text output
+const (
+	FORMAT_JSON  = "json"
+	FORMAT_YAML  = "yaml"
+	FORMAT_CSV   = "csv"
+	FORMAT_TABLE = "table"
+)
+
+var outputFormats = []string{FORMAT_JSON, FORMAT_YAML, FORMAT_CSV, FORMAT_TABLE}
+
+var xmlNameType = reflect.TypeOf(xml.Name{})
+var timeType = reflect.TypeOf(time.Time{})
+
+//Implemented by the data printed through a template which only wraps the data to format,
+//e.g. adding flags used by the template
+type dataWrapper interface {
+	wrapped() interface{}
+}
+
+//A message returned by a command instead of data
+type formattedMessage struct {
+	Message string `json:"message"`
+}
+
+//Writes the data in the format. JSON and YAML keep the whole structure, CSV and tables have
+//a row per item and a column per value, the values of nested structures are prefixed by
+//their name and lists are left out. Messages (strings) are written as a value with a single
+//message field so the output can still be parsed
+func writeFormatted(w io.Writer, format string, data interface{}) error {
+	if wrapper, ok := data.(dataWrapper); ok {
+		data = wrapper.wrapped()
+	}
+	if message, ok := data.(string); ok {
+		data = formattedMessage{strings.TrimSpace(message)}
+	}
+	switch format {
+	case FORMAT_JSON:
+		out, err := json.MarshalIndent(plainValue(reflect.ValueOf(data)), "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	case FORMAT_YAML:
+		out, err := goyaml.Marshal(plainValue(reflect.ValueOf(data)))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(out)
+		return err
+	case FORMAT_CSV:
+		writer := csv.NewWriter(w)
+		writer.WriteAll(tableRows(reflect.ValueOf(data)))
+		return writer.Error()
+	case FORMAT_TABLE:
+		writer := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		for idx, row := range tableRows(reflect.ValueOf(data)) {
+			if idx == 0 {
+				for col := range row {
+					row[col] = strings.ToUpper(row[col])
+				}
+			}
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+	return fmt.Errorf("Unknown format %v", format)
+}
+
+//Returns the name of the field in the formatted data: the json name, the name in the
+//webservice's xml or the field name starting in lower case. False if it's left out
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" || field.Type == xmlNameType {
+		return "", false
+	}
+	if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+		return "", false
+	} else if tag != "" {
+		return tag, true
+	}
+	if tag := strings.Split(field.Tag.Get("xml"), ",")[0]; tag == "-" {
+		return "", false
+	} else if tag != "" {
+		//drop the namespace
+		parts := strings.Fields(tag)
+		return parts[len(parts)-1], true
+	}
+	name := []rune(field.Name)
+	name[0] = unicode.ToLower(name[0])
+	return string(name), true
+}
+
+//Secrets are never printed
+func maskSecret(name string, value interface{}) interface{} {
+	if secret, ok := value.(string); ok && name == "secret" && secret != "" {
+		return "****"
+	}
+	return value
+}
+
+//Returns the value as written in a cell, empty if there's none
+func cellValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+//Converts the value into maps, lists and basic values that serialise under the field names
+func plainValue(v reflect.Value) interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch {
+	case !v.IsValid():
+		return nil
+	case v.Type() == timeType:
+		return v.Interface().(time.Time).Format(time.RFC3339)
+	case v.Kind() == reflect.Struct:
+		fields := map[string]interface{}{}
+		for idx := 0; idx < v.NumField(); idx++ {
+			if name, ok := fieldName(v.Type().Field(idx)); ok {
+				fields[name] = maskSecret(name, plainValue(v.Field(idx)))
+			}
+		}
+		return fields
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return string(v.Bytes())
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		items := []interface{}{}
+		for idx := 0; idx < v.Len(); idx++ {
+			items = append(items, plainValue(v.Index(idx)))
+		}
+		return items
+	case v.Kind() == reflect.Map:
+		entries := map[string]interface{}{}
+		for _, key := range v.MapKeys() {
+			entries[fmt.Sprint(key.Interface())] = plainValue(v.MapIndex(key))
+		}
+		return entries
+	}
+	return v.Interface()
+}
+
+//Returns the header and a row per item of the list, or a single row if the value isn't a list
+func tableRows(v reflect.Value) [][]string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return [][]string{}
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return [][]string{}
+	}
+	items := []reflect.Value{v}
+	itemType := v.Type()
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		items = []reflect.Value{}
+		for idx := 0; idx < v.Len(); idx++ {
+			items = append(items, v.Index(idx))
+		}
+		itemType = v.Type().Elem()
+	}
+	//the header is known even if there are no items
+	header, _ := flatFields(reflect.Zero(itemType), "")
+	rows := [][]string{header}
+	for _, item := range items {
+		_, values := flatFields(item, "")
+		rows = append(rows, values)
+	}
+	return rows
+}
+
+//Returns the names and values of the basic fields of the struct, the fields of nested
+//structs are prefixed by their name. A value which isn't a struct is a single column
+func flatFields(v reflect.Value, prefix string) (names, values []string) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+	if v.Kind() != reflect.Struct || v.Type() == timeType {
+		value := ""
+		if v.IsValid() {
+			value = cellValue(plainValue(v))
+		}
+		return []string{"value"}, []string{value}
+	}
+	for idx := 0; idx < v.NumField(); idx++ {
+		name, ok := fieldName(v.Type().Field(idx))
+		if !ok {
+			continue
+		}
+		field := v.Field(idx)
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				field = reflect.Zero(field.Type().Elem())
+			} else {
+				field = field.Elem()
+			}
+		}
+		switch {
+		case field.Kind() == reflect.Struct && field.Type() != timeType:
+			nestedNames, nestedValues := flatFields(field, prefix+name+".")
+			names = append(names, nestedNames...)
+			values = append(values, nestedValues...)
+		case field.Kind() == reflect.Slice || field.Kind() == reflect.Array || field.Kind() == reflect.Map:
+			//not a single value
+		default:
+			names = append(names, prefix+name)
+			values = append(values, cellValue(maskSecret(name, plainValue(field))))
+		}
+	}
+	return
+}
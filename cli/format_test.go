@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func TestWriteFormattedJson(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := writeFormatted(out, FORMAT_JSON, []pipeline.Job{JOB_1}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	jobs := []map[string]interface{}{}
+	if err := json.Unmarshal(out.Bytes(), &jobs); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(jobs) != 1 || jobs[0]["id"] != "job1" || jobs[0]["nicename"] != "my_little_job" || jobs[0]["priority"] != "low" {
+		t.Errorf("Wrong json %s", out.String())
+	}
+	if _, ok := jobs[0]["XMLName"]; ok {
+		t.Errorf("XML names written %s", out.String())
+	}
+	messages := jobs[0]["messages"].(map[string]interface{})["message"].([]interface{})
+	if len(messages) != 2 {
+		t.Errorf("Nested messages not written %s", out.String())
+	}
+}
+
+func TestWriteFormattedCsv(t *testing.T) {
+	out := new(bytes.Buffer)
+	clients := []pipeline.Client{pipeline.Client{Id: "client", Role: "ADMIN", Secret: "pass"}}
+	if err := writeFormatted(out, FORMAT_CSV, clients); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := "secret,href,role,id,contact,priority\n****,,ADMIN,client,,\n"
+	if out.String() != expected {
+		t.Errorf("Wrong csv %q", out.String())
+	}
+	out.Reset()
+	//nested structs are flattened
+	if err := writeFormatted(out, FORMAT_CSV, []pipeline.Job{}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if header := out.String(); !strings.Contains(header, ",script.id,") || !strings.Contains(header, ",messages.progress,") {
+		t.Errorf("Wrong header %q", header)
+	}
+}
+
+func TestWriteFormattedTable(t *testing.T) {
+	out := new(bytes.Buffer)
+	sizes := []jobDataSize{{Id: "job1", Context: 1, Output: 2, Log: 3, Total: 6}, {Id: "job10", Total: 100}}
+	if err := writeFormatted(out, FORMAT_TABLE, sizes); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := "ID     CONTEXT  OUTPUT  LOG  TOTAL\n" +
+		"job1   1        2       3    6\n" +
+		"job10  0        0       0    100\n"
+	if out.String() != expected {
+		t.Errorf("Wrong table %q", out.String())
+	}
+}
+
+func TestFormatOption(t *testing.T) {
+	cli, link, _ := makeReturningCli(pipeline.JobSizes{Total: 10, JobSizes: []pipeline.JobSize{{Id: "job1", Context: 2, Output: 3, Log: 3}}}, t)
+	r := overrideOutput(cli)
+	cli.AddSizesCommand(link)
+	if err := cli.Run([]string{"--format", "yaml", "sizes", "-l"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !strings.Contains(r.String(), "id: job1") || !strings.Contains(r.String(), "total: 8") {
+		t.Errorf("Wrong yaml %q", r.String())
+	}
+	cli, link, _ = makeReturningCli(pipeline.JobSizes{Total: 10}, t)
+	cli.AddSizesCommand(link)
+	if _, ok := cli.Run([]string{"--format", "xml", "sizes"}).(ValidationError); !ok {
+		t.Errorf("Invalid format didn't error")
+	}
+}
+
+func TestFormatOptionStatus(t *testing.T) {
+	cli, link, _ := makeReturningCli(nil, t)
+	r := overrideOutput(cli)
+	AddJobStatusCommand(cli, link)
+	if err := cli.Run([]string{"--format", "json", "status", "job1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	job := map[string]interface{}{}
+	if err := json.Unmarshal(r.Bytes(), &job); err != nil {
+		t.Fatalf("Unexpected error %v in %q", err, r.String())
+	}
+	if job["id"] != "job1" || job["status"] != "RUNNING" {
+		t.Errorf("Wrong status %q", r.String())
+	}
+}
+
+func TestFormatOptionMessage(t *testing.T) {
+	cli, link, pipe := makeReturningCli(nil, t)
+	pipe.delete = func(id string) (bool, error) {
+		return true, nil
+	}
+	r := overrideOutput(cli)
+	AddDeleteCommand(cli, link)
+	if err := cli.Run([]string{"--format", "json", "delete", "job1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	message := map[string]interface{}{}
+	if err := json.Unmarshal(r.Bytes(), &message); err != nil {
+		t.Fatalf("Unexpected error %v in %q", err, r.String())
+	}
+	if len(message) != 1 || !strings.Contains(message["message"].(string), "job1") {
+		t.Errorf("Wrong message %q", r.String())
+	}
+	out := new(bytes.Buffer)
+	if err := writeFormatted(out, FORMAT_CSV, "Done\n"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if out.String() != "message\nDone\n" {
+		t.Errorf("Wrong csv %q", out.String())
+	}
+}
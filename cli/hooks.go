@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/bertfrees/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Commands run once a job followed by dp2 ends and its results are stored
+type jobHooks struct {
+	onSuccess string
+	onFailure string
+}
+
+//Adds the options to set the commands run when the job ends
+func addHooksOptions(cmd *subcommand.Command, hooks *jobHooks) {
+	cmd.AddOption("on-success", "", "Command run when the job succeeds, once its results are stored. The job's id, script, nicename, status and output are available in the DP2_JOB_ID, DP2_SCRIPT, DP2_NICENAME, DP2_STATUS and DP2_OUTPUT environment variables (by default the "+ONSUCCESS+" configuration)", "", "COMMAND", func(name, command string) error {
+		hooks.onSuccess = command
+		return nil
+	})
+	cmd.AddOption("on-failure", "", "Command run when the job finishes with status FAIL or ERROR, with the same environment variables as --on-success (by default the "+ONFAILURE+" configuration)", "", "COMMAND", func(name, command string) error {
+		hooks.onFailure = command
+		return nil
+	})
+}
+
+//Returns the command to run for a job which finished with the status, the
+//configured one if none was given. Empty if there's nothing to run
+func (h jobHooks) command(status string, conf Config) string {
+	command, key := "", ""
+	switch status {
+	case "SUCCESS":
+		command, key = h.onSuccess, ONSUCCESS
+	case "FAIL", "ERROR":
+		command, key = h.onFailure, ONFAILURE
+	default:
+		return ""
+	}
+	if command == "" {
+		command, _ = conf[key].(string)
+	}
+	return command
+}
+
+//Runs the hook for the job's status through the shell, its output goes to out. A
+//HookError is returned if it couldn't be run or exited with an error
+func (h jobHooks) run(jobId, script, nicename, status, output string, conf Config, out io.Writer) error {
+	command := h.command(status, conf)
+	if command == "" {
+		return nil
+	}
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(),
+		"DP2_JOB_ID="+jobId,
+		"DP2_SCRIPT="+script,
+		"DP2_NICENAME="+nicename,
+		"DP2_STATUS="+status,
+		"DP2_OUTPUT="+output,
+	)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		code := -1
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			code = exitErr.ExitCode()
+		}
+		return HookError{Command: command, Code: code, Err: err}
+	}
+	return nil
+}
+
+//Runs the hook for the job which ended with the status, its output goes to stderr when
+//events are written so the stream isn't broken, or when the job is run by batch or watch
+//which don't print the job's output
+func (j jobExecution) runHooks(job pipeline.Job, status, output string, stdOut io.Writer) error {
+	script, nicename := j.req.Script, j.req.Nicename
+	if script == "" {
+		//attached to a job sent by someone else
+		script, nicename = jobScriptId(job), job.Nicename
+	}
+	if j.events != "" || j.unattended {
+		stdOut = os.Stderr
+	}
+	return j.hooks.run(job.Id, script, nicename, status, output, j.link.config, stdOut)
+}
+
+//Creates the command to run the line through the system's shell
+func shellCommand(line string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", line)
+	}
+	return exec.Command("sh", "-c", line)
+}
+
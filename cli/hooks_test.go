@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"testing"
+)
+
+func TestHooksCommand(t *testing.T) {
+	conf := Config{ONSUCCESS: "configured success", ONFAILURE: "configured failure"}
+	hooks := jobHooks{onSuccess: "success"}
+	for status, expected := range map[string]string{
+		"SUCCESS": "success",
+		"FAIL":    "configured failure",
+		"ERROR":   "configured failure",
+		"RUNNING": "",
+	} {
+		if command := hooks.command(status, conf); command != expected {
+			t.Errorf("Wrong command for %v: %q", status, command)
+		}
+	}
+}
+
+func TestHooksRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hooks are run through sh")
+	}
+	out := new(bytes.Buffer)
+	hooks := jobHooks{onSuccess: `echo "$DP2_JOB_ID $DP2_SCRIPT $DP2_NICENAME $DP2_STATUS $DP2_OUTPUT"`, onFailure: "exit 3"}
+	if err := hooks.run("job1", "test", "nice", "SUCCESS", "/tmp/out", Config{}, out); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if out.String() != "job1 test nice SUCCESS /tmp/out\n" {
+		t.Errorf("Wrong environment %q", out.String())
+	}
+	err := hooks.run("job1", "test", "nice", "FAIL", "/tmp/out", Config{}, out)
+	var hookErr HookError
+	if !errors.As(err, &hookErr) || hookErr.Code != 3 {
+		t.Errorf("Expected a hook error with code 3 got %#v", err)
+	}
+}
+
+//The job's status is reported before the failure of the hook
+func TestHooksErrorList(t *testing.T) {
+	var errs errorList
+	errs.add(jobStatusError("job1", "FAIL"))
+	errs.add(HookError{Command: "exit 3", Code: 3})
+	var statusErr JobStatusError
+	if !errors.As(errs.err(), &statusErr) || statusErr.Status != "FAIL" {
+		t.Errorf("Job status lost %v", errs.err())
+	}
+}
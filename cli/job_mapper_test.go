@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"sync"
 	"testing"
 
 	"github.com/daisy/pipeline-clientlib-go"
@@ -57,6 +58,7 @@ func TestOr(t *testing.T) {
 
 func TestMap(t *testing.T) {
 	ids := map[string]bool{}
+	mutex := sync.Mutex{}
 	msgs := map[string]bool{}
 	jobs := []pipeline.Job{
 		pipeline.Job{
@@ -73,7 +75,9 @@ func TestMap(t *testing.T) {
 		},
 	}
 	fn := func(j pipeline.Job, c chan string) {
+		mutex.Lock()
 		ids[j.Id] = true
+		mutex.Unlock()
 		c <- j.Id
 	}
 
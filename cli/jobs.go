@@ -0,0 +1,168 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bertfrees/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Statuses a job can be in
+var jobStatuses = []string{"IDLE", "RUNNING", "SUCCESS", "ERROR", "FAIL"}
+
+//Columns of the jobs list, the first three are always shown. There's no creation time as the
+//clientlib's jobs have no timestamps, see the README
+var jobColumns = []string{"id", "nicename", "status", "priority", "script", "batch"}
+
+//Header and cell of the optional columns in the jobs list
+var jobColumnTemplates = map[string][2]string{
+	"priority": {"Priority", "{{.Priority}}"},
+	"script":   {"Script", "{{.Script.Id}}"},
+	"batch":    {"Batch", "{{.BatchId}}"},
+}
+
+//Jobs to list and how: filters, order, number of jobs and extra columns
+type jobQuery struct {
+	statuses []string
+	scripts  []string
+	nicename string //glob pattern
+	sortBy   string
+	desc     bool
+	limit    int
+	columns  []string
+}
+
+//Adds the options to filter, sort and limit the listed jobs and choose the columns
+func addJobQueryOptions(cmd *subcommand.Command, query *jobQuery) {
+	cmd.AddOption("status", "", "Only list the jobs with the status, may be repeated or comma separated: "+strings.Join(jobStatuses, ", "), "", "STATUS", func(name, value string) error {
+		for _, status := range splitPatterns(strings.ToUpper(value)) {
+			if !contains(jobStatuses, status) {
+				return ValidationError{fmt.Errorf("%v is not a valid value for --%v. Allowed values are %v", status, name, strings.Join(jobStatuses, ", "))}
+			}
+			query.statuses = append(query.statuses, status)
+		}
+		return nil
+	})
+	cmd.AddOption("script", "", "Only list the jobs of the script, may be repeated or comma separated", "", "SCRIPT", func(name, value string) error {
+		query.scripts = append(query.scripts, splitPatterns(value)...)
+		return nil
+	})
+	cmd.AddOption("nicename", "", "Only list the jobs whose nicename matches the pattern", "", "GLOB", func(name, value string) error {
+		if _, err := path.Match(value, ""); err != nil {
+			return ValidationError{fmt.Errorf("%v is not a valid pattern for --%v: %v", value, name, err)}
+		}
+		query.nicename = value
+		return nil
+	})
+	cmd.AddOption("sort", "", "Sort the jobs by the column, in descending order if prefixed with a dash: "+strings.Join(jobColumns, ", "), "", "COLUMN", func(name, value string) error {
+		query.desc = strings.HasPrefix(value, "-")
+		query.sortBy = strings.TrimPrefix(value, "-")
+		if !contains(jobColumns, query.sortBy) {
+			return ValidationError{fmt.Errorf("%v is not a valid value for --%v. Allowed values are %v", value, name, strings.Join(jobColumns, ", "))}
+		}
+		return nil
+	})
+	cmd.AddOption("limit", "", "List at most N jobs", "", "N", func(name, value string) error {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return ValidationError{fmt.Errorf("%v is not a valid value for --%v, a positive number is expected", value, name)}
+		}
+		query.limit = limit
+		return nil
+	})
+	cmd.AddOption("columns", "", "Extra columns to show, comma separated: "+strings.Join(jobColumns[3:], ", "), "", "COLUMNS", func(name, value string) error {
+		for _, column := range splitPatterns(value) {
+			if _, ok := jobColumnTemplates[column]; !ok {
+				return ValidationError{fmt.Errorf("%v is not a valid value for --%v. Allowed values are %v", column, name, strings.Join(jobColumns[3:], ", "))}
+			}
+			query.columns = append(query.columns, column)
+		}
+		return nil
+	})
+}
+
+//Returns the script id of the job, the job list may only give the script's href
+func jobScriptId(job pipeline.Job) string {
+	if job.Script.Id == "" && job.Script.Href != "" {
+		return path.Base(job.Script.Href)
+	}
+	return job.Script.Id
+}
+
+//Checks if the job passes the filters
+func (q jobQuery) matches(job pipeline.Job) bool {
+	if len(q.statuses) > 0 && !contains(q.statuses, job.Status) {
+		return false
+	}
+	if len(q.scripts) > 0 && !contains(q.scripts, job.Script.Id) {
+		return false
+	}
+	if q.nicename != "" {
+		if ok, _ := path.Match(q.nicename, job.Nicename); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+//Value of the column used to sort the jobs, priorities are sorted from low to high
+func jobColumnValue(job pipeline.Job, column string) string {
+	switch column {
+	case "nicename":
+		return job.Nicename
+	case "status":
+		return job.Status
+	case "priority":
+		return strconv.Itoa(map[string]int{"low": 1, "medium": 2, "high": 3}[job.Priority])
+	case "script":
+		return job.Script.Id
+	case "batch":
+		return job.BatchId
+	}
+	return job.Id
+}
+
+//Returns the jobs passing the filters, sorted and limited. Jobs keep the server's
+//order when they are not sorted or have the same value
+func (q jobQuery) apply(jobs []pipeline.Job) []pipeline.Job {
+	listed := []pipeline.Job{}
+	for _, job := range jobs {
+		job.Script.Id = jobScriptId(job)
+		if q.matches(job) {
+			listed = append(listed, job)
+		}
+	}
+	if q.sortBy != "" {
+		sort.SliceStable(listed, func(i, j int) bool {
+			a, b := jobColumnValue(listed[i], q.sortBy), jobColumnValue(listed[j], q.sortBy)
+			if q.desc {
+				return a > b
+			}
+			return a < b
+		})
+	}
+	if q.limit > 0 && len(listed) > q.limit {
+		listed = listed[:q.limit]
+	}
+	return listed
+}
+
+//Returns the template of the jobs list with the extra columns, the nicename column is kept
+//when empty so the columns line up
+func (q jobQuery) template() string {
+	if len(q.columns) == 0 {
+		return JobListTemplate
+	}
+	header, cells := "", ""
+	for _, column := range q.columns {
+		header += "\t" + jobColumnTemplates[column][0]
+		cells += "\t" + jobColumnTemplates[column][1]
+	}
+	return `Job Id          (Nicename)              [STATUS]` + header + `
+{{range .}}{{.Id}}	{{if .Nicename }}({{.Nicename}}){{end}}	[{{.Status}}]` + cells + `
+{{end}}`
+}
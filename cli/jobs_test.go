@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+var LISTED_JOBS = []pipeline.Job{
+	pipeline.Job{Id: "job1", Nicename: "book one", Status: "SUCCESS", Priority: "low", Script: pipeline.Script{Href: "http://localhost/ws/scripts/dtbook-to-epub3"}},
+	pipeline.Job{Id: "job2", Nicename: "book two", Status: "FAIL", Priority: "high", Script: pipeline.Script{Id: "dtbook-to-epub3"}},
+	pipeline.Job{Id: "job3", Nicename: "report", Status: "RUNNING", Priority: "medium", Script: pipeline.Script{Id: "html-to-pef"}},
+	pipeline.Job{Id: "job4", Status: "SUCCESS", Priority: "high", Script: pipeline.Script{Id: "html-to-pef"}},
+}
+
+func listedIds(jobs []pipeline.Job) string {
+	ids := []string{}
+	for _, job := range jobs {
+		ids = append(ids, job.Id)
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestJobQueryApply(t *testing.T) {
+	for _, test := range []struct {
+		query    jobQuery
+		expected string
+	}{
+		{jobQuery{}, "job1 job2 job3 job4"},
+		{jobQuery{statuses: []string{"SUCCESS", "FAIL"}}, "job1 job2 job4"},
+		{jobQuery{scripts: []string{"dtbook-to-epub3"}}, "job1 job2"},
+		{jobQuery{nicename: "book*"}, "job1 job2"},
+		{jobQuery{sortBy: "priority", desc: true}, "job2 job4 job3 job1"},
+		{jobQuery{sortBy: "nicename", limit: 2}, "job4 job1"},
+	} {
+		if ids := listedIds(test.query.apply(LISTED_JOBS)); ids != test.expected {
+			t.Errorf("Wrong jobs for %+v: %v", test.query, ids)
+		}
+	}
+}
+
+func TestJobsCommandOptions(t *testing.T) {
+	cli, link, _ := makeReturningCli(pipeline.Jobs{Jobs: LISTED_JOBS}, t)
+	r := overrideOutput(cli)
+	AddJobsCommand(cli, link)
+	err := cli.Run([]string{"jobs", "--status", "success", "--sort", "-id", "--columns", "priority,script"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	lines := strings.Split(r.String(), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[0], "\tPriority\tScript") {
+		t.Fatalf("Wrong list %q", r.String())
+	}
+	if lines[1] != "job4\t\t[SUCCESS]\thigh\thtml-to-pef" || lines[2] != "job1\t(book one)\t[SUCCESS]\tlow\tdtbook-to-epub3" {
+		t.Errorf("Wrong rows %q", r.String())
+	}
+	for _, args := range [][]string{
+		{"jobs", "--status", "DONE"},
+		{"jobs", "--sort", "size"},
+		{"jobs", "--limit", "0"},
+		{"jobs", "--columns", "size"},
+	} {
+		cli, link, _ := makeReturningCli(pipeline.Jobs{Jobs: LISTED_JOBS}, t)
+		AddJobsCommand(cli, link)
+		if _, ok := cli.Run(args).(ValidationError); !ok {
+			t.Errorf("Expected a validation error for %v", args)
+		}
+	}
+}
@@ -1,13 +1,18 @@
 package cli
 
 import (
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"math/rand"
 	"os"
 	"os/exec"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,9 +21,23 @@ import (
 )
 
 const (
-	MSG_WAIT = 1000 * time.Millisecond //waiting time for getting messages
+	RETRY_WAIT     = 1000 * time.Millisecond //waiting time before retrying a failed poll, doubled on every attempt
+	RETRY_MAX_WAIT = 30 * time.Second        //maximum waiting time between retries
 )
 
+//Waits between polls for the duration, unless done is closed before. Returns false if it
+//was (mockable for testing)
+var sleep = func(d time.Duration, done <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
 //Convinience for testing, propably move to pipeline-clientlib-go
 type PipelineApi interface {
 	SetCredentials(string, string)
@@ -59,7 +78,7 @@ type PipelineLink struct {
 func NewLink(conf Config) (pLink *PipelineLink) {
 
 	pLink = &PipelineLink{
-		pipeline: pipeline.NewPipeline(conf.Url()),
+		pipeline: newStreamingPipeline(conf.Url()),
 		config:   conf,
 	}
 	//assure that the pipeline is up
@@ -71,12 +90,12 @@ func (p *PipelineLink) Init() error {
 	log.Println("Initialising link")
 	p.pipeline.SetUrl(p.config.Url())
 	if err := bringUp(p); err != nil {
-		return err
+		return ConnectionError{err}
 	}
 	//set the credentials
 	if p.Authentication {
 		if !(len(p.config[CLIENTKEY].(string)) > 0 && len(p.config[CLIENTSECRET].(string)) > 0) {
-			return errors.New("link: Authentication required but client_key and client_secret are not set. Please, check the configuration")
+			return AuthError{errors.New("link: Authentication required but client_key and client_secret are not set. Please, check the configuration")}
 		}
 		p.pipeline.SetCredentials(p.config[CLIENTKEY].(string), p.config[CLIENTSECRET].(string))
 	}
@@ -218,6 +237,11 @@ func (p PipelineLink) Scripts() (scripts []pipeline.Script, err error) {
 	return scripts, err
 }
 
+//Gets the complete definition of the script identified by id
+func (p PipelineLink) Script(id string) (script pipeline.Script, err error) {
+	return p.pipeline.Script(id)
+}
+
 //Gets the job identified by the jobId
 func (p PipelineLink) Job(jobId string) (job pipeline.Job, err error) {
 	job, err = p.pipeline.Job(jobId, 0)
@@ -291,6 +315,7 @@ type Message struct {
 	Message  string
 	Level    string
 	Depth    int
+	Sequence int
 	Status   string
 	Progress float64
 	Error    error
@@ -323,26 +348,57 @@ func (m Message) String() string {
 }
 
 //Executes the job request and returns a channel fed with the job's messages,errors, and status.
-//The last message will have no contents but the status of the in which the job finished
-func (p PipelineLink) Execute(jobReq JobRequest) (job pipeline.Job, messages chan Message, err error) {
+//The last message will have no contents but the status of the in which the job finished.
+//Closing done stops feeding the channel, see getAsyncMessages
+func (p PipelineLink) Execute(jobReq JobRequest, done <-chan struct{}) (job pipeline.Job, messages chan Message, err error) {
+	defer jobReq.closeData()
 	req, err := jobRequestToPipeline(jobReq, p)
 	if err != nil {
+		err = ValidationError{err}
 		return
 	}
-	log.Printf("data len exec %v", len(jobReq.Data))
-	job, err = p.pipeline.JobRequest(req, jobReq.Data)
+	if jobReq.SavePath != "" {
+		if err = saveJobRequest(req, jobReq.SavePath); err != nil {
+			return
+		}
+	}
+	job, err = p.sendJobRequest(req, jobReq.Data)
 	if err != nil {
+		err = linkError(err)
 		return
 	}
 	messages = make(chan Message)
 	if !jobReq.Background {
-		go getAsyncMessages(p, job.Id, messages)
+		go getAsyncMessages(p, job.Id, messages, done)
 	} else {
 		close(messages)
 	}
 	return
 }
 
+//Sends a job request loaded from a file. The script is looked up by its id in the webservice
+//the client is connected to, which may not be the one where the request was saved
+func (p PipelineLink) Submit(req pipeline.JobRequest, data io.Reader) (job pipeline.Job, err error) {
+	req.Script.Href = p.pipeline.ScriptUrl(path.Base(req.Script.Href))
+	job, err = p.sendJobRequest(req, data)
+	return job, linkError(err)
+}
+
+//Sends the job request streaming the data when the client supports it
+func (p PipelineLink) sendJobRequest(req pipeline.JobRequest, data io.Reader) (job pipeline.Job, err error) {
+	if data == nil {
+		return p.pipeline.JobRequest(req, nil)
+	}
+	if streamer, ok := p.pipeline.(dataStreamer); ok {
+		return streamer.JobRequestStream(req, data)
+	}
+	bytes, err := ioutil.ReadAll(data)
+	if err != nil {
+		return
+	}
+	return p.pipeline.JobRequest(req, bytes)
+}
+
 func (p PipelineLink) StylesheetParameters(paramReq StylesheetParametersRequest) (params pipeline.StylesheetParameters, err error) {
 	req := pipeline.StylesheetParametersRequest{
 		Media:               pipeline.Media{Value: paramReq.Medium},
@@ -353,55 +409,163 @@ func (p PipelineLink) StylesheetParameters(paramReq StylesheetParametersRequest)
 	return
 }
 
-//Feeds the channel with the messages describing the job's execution
-func getAsyncMessages(p PipelineLink, jobId string, messages chan Message) {
+//Stops getAsyncMessages feeding the channel and waits until it has returned
+func stopFollowing(messages chan Message, done chan struct{}) {
+	close(done)
+	for range messages {
+	}
+}
+
+//Feeds the channel with the messages describing the job's execution. The job is polled
+//more often while it shows activity, through the scheduler shared by all the jobs followed.
+//Failed polls are retried, reconnecting to the webservice if needed, and the messages carry
+//on from the last one received. It stops, closing the channel, once done is closed
+func getAsyncMessages(p PipelineLink, jobId string, messages chan Message, done <-chan struct{}) {
+	defer close(messages)
+	//false once nobody reads the messages anymore
+	send := func(msg Message) bool {
+		select {
+		case messages <- msg:
+			return true
+		case <-done:
+			return false
+		}
+	}
 	msgSeq := -1
+	failures := 0
+	interval := newPollInterval(p.config)
+	progress := -1.0
+	status := ""
 	for {
 		job, err := p.pipeline.Job(jobId, msgSeq)
 		if err != nil {
-			messages <- Message{Error: err}
-			close(messages)
-			return
+			err = linkError(err)
+			if _, denied := err.(AuthError); denied || failures >= p.config.intValue(POLLRETRIES) {
+				send(Message{Error: err})
+				return
+			}
+			failures++
+			wait := backoff(failures)
+			log.Printf("Polling job %v failed (attempt %v), retrying in %v: %v", jobId, failures, wait, err)
+			if !polls.wait(wait, interval.min, done) {
+				return
+			}
+			p.reconnect(err)
+			continue
 		}
+		failures = 0
 		n := msgSeq
 		if len(job.Messages.Message) > 0 {
-			n = flattenMessages(job.Messages.Message, messages, job.Status, job.Messages.Progress, msgSeq + 1, 0)
+			var msgs []Message
+			msgs, n = flatMessages(job.Messages.Message, job.Status, job.Messages.Progress, msgSeq + 1, 0)
+			for _, msg := range msgs {
+				if !send(msg) {
+					return
+				}
+			}
 		}
+		activity := n > msgSeq || job.Messages.Progress != progress || job.Status != status
+		progress = job.Messages.Progress
+		status = job.Status
 		if (n > msgSeq) {
 			msgSeq = n
-		} else {
-			messages <- Message{Progress: job.Messages.Progress}
+		} else if !send(Message{Progress: job.Messages.Progress}) {
+			return
 		}
 		if job.Status == "SUCCESS" || job.Status == "ERROR" || job.Status == "FAIL" {
-			messages <- Message{Status: job.Status}
-			close(messages)
+			send(Message{Status: job.Status})
+			return
+		}
+		if !polls.wait(interval.next(activity), interval.min, done) {
 			return
 		}
-		time.Sleep(MSG_WAIT)
 	}
 
 }
 
+//Returns the waiting time before the given retry. It grows exponentially and is randomised
+//so that clients which lost the connection at once don't retry at once
+func backoff(attempt int) time.Duration {
+	wait := RETRY_WAIT
+	for i := 1; i < attempt && wait < RETRY_MAX_WAIT; i++ {
+		wait *= 2
+	}
+	if wait > RETRY_MAX_WAIT {
+		wait = RETRY_MAX_WAIT
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+//Brings the webservice up again after a connection error, in case it was restarted
+func (p *PipelineLink) reconnect(err error) {
+	switch err.(type) {
+	case ConnectionError, TimeoutError:
+	default:
+		return
+	}
+	if err := bringUp(p); err != nil {
+		log.Printf("Reconnecting failed: %v", err)
+		return
+	}
+	if p.Authentication {
+		p.pipeline.SetCredentials(p.config[CLIENTKEY].(string), p.config[CLIENTSECRET].(string))
+	}
+}
+
 //Flatten message coming from the Pipeline job and feed them into the channel
 //Return the sequence number of the inner message with the highest sequence number
 func flattenMessages(from []pipeline.Message, to chan Message, status string, progress float64, firstSeq int, depth int) (lastSeq int) {
+	msgs, lastSeq := flatMessages(from, status, progress, firstSeq, depth)
+	for _, msg := range msgs {
+		to <- msg
+	}
+	return lastSeq
+}
+
+//Returns the messages flattenMessages feeds into the channel and the last sequence number
+func flatMessages(from []pipeline.Message, status string, progress float64, firstSeq int, depth int) (msgs []Message, lastSeq int) {
 	lastSeq = -1
 	for _, msg := range from {
 		seq := msg.Sequence
 		if seq >= firstSeq {
-			to <- Message{Message: msg.Content, Level: msg.Level, Depth: depth, Status: status, Progress: progress}
+			msgs = append(msgs, Message{Message: msg.Content, Level: msg.Level, Depth: depth, Sequence: seq, Status: status, Progress: progress})
 			if seq > lastSeq {
 				lastSeq = seq
 			}
 		}
 		if len(msg.Message) > 0 {
-			seq := flattenMessages(msg.Message, to, status, progress, firstSeq, depth + 1)
+			nested, seq := flatMessages(msg.Message, status, progress, firstSeq, depth + 1)
+			msgs = append(msgs, nested...)
 			if seq > lastSeq {
 				lastSeq = seq
 			}
 		}
 	}
-	return lastSeq
+	return msgs, lastSeq
+}
+
+//Writes the job request in the XML format accepted by the webservice
+func saveJobRequest(req pipeline.JobRequest, file string) error {
+	bytes, err := xml.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append([]byte(xml.Header), append(bytes, '\n')...), 0644)
+}
+
+//Reads a job request written by saveJobRequest
+func loadJobRequest(file string) (req pipeline.JobRequest, err error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = xml.Unmarshal(bytes, &req); err != nil {
+		return req, fmt.Errorf("%v is not a valid job request: %v", file, err)
+	}
+	if req.Script.Href == "" {
+		return req, fmt.Errorf("%v is not a valid job request: the script is missing", file)
+	}
+	return
 }
 
 func jobRequestToPipeline(req JobRequest, p PipelineLink) (pipeline.JobRequest, error) {
@@ -411,33 +575,48 @@ func jobRequestToPipeline(req JobRequest, p PipelineLink) (pipeline.JobRequest,
 		Nicename: req.Nicename,
 		Priority: req.Priority,
 	}
-	for name, values := range req.Inputs {
+	//all the invalid values are reported, not only the first one
+	var errs errorList
+	inputNames := []string{}
+	for name := range req.Inputs {
+		inputNames = append(inputNames, name)
+	}
+	sort.Strings(inputNames)
+	for _, name := range inputNames {
 		input := pipeline.Input{Name: name}
-		for _, v := range values {
-			value, err := v(req.Data)
+		for _, v := range req.Inputs[name] {
+			value, err := v(req.RemoteData)
 			if (err != nil) {
-				return pReq, err
+				errs.add(err)
+				continue
 			}
 			input.Items = append(input.Items, pipeline.Item{Value: value.String()})
 		}
 		pReq.Inputs = append(pReq.Inputs, input)
 	}
+	optionNames := []string{}
+	for name := range req.Options {
+		optionNames = append(optionNames, name)
+	}
+	sort.Strings(optionNames)
 	var stylesheetParametersOption pipeline.Option
-	for name, values := range req.Options {
+	for _, name := range optionNames {
+		values := req.Options[name]
 		option := pipeline.Option{Name: name}
 		if len(values) > 1 {
 			for _, v := range values {
-				value, err := v(req.Data)
+				value, err := v(req.RemoteData)
 				if (err != nil) {
-					return pReq, err
+					errs.add(err)
+					continue
 				}
 				option.Items = append(option.Items, pipeline.Item{Value: value})
 			}
 		} else {
 			var err error
-			option.Value, err = values[0](req.Data)
+			option.Value, err = values[0](req.RemoteData)
 			if (err != nil) {
-				return pReq, err
+				errs.add(err)
 			}
 		}
 		if name == "stylesheet-parameters" {
@@ -446,11 +625,17 @@ func jobRequestToPipeline(req JobRequest, p PipelineLink) (pipeline.JobRequest,
 			pReq.Options = append(pReq.Options, option)
 		}
 	}
+	paramNames := []string{}
+	for name := range req.StylesheetParameters {
+		paramNames = append(paramNames, name)
+	}
+	sort.Strings(paramNames)
 	var params []string
-	for name, p := range req.StylesheetParameters {
-		param, err := p(req.Data)
+	for _, name := range paramNames {
+		param, err := req.StylesheetParameters[name](req.RemoteData)
 		if (err != nil) {
-			return pReq, err
+			errs.add(err)
+			continue
 		}
 		switch param.Type.(type) {
 		case pipeline.XsBoolean,
@@ -485,5 +670,5 @@ func jobRequestToPipeline(req JobRequest, p PipelineLink) (pipeline.JobRequest,
 	if stylesheetParametersOption.Name != "" {
 		pReq.Options = append(pReq.Options, stylesheetParametersOption)
 	}
-	return pReq, nil
+	return pReq, errs.err()
 }
@@ -1,10 +1,13 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/daisy/pipeline-clientlib-go"
 )
@@ -13,44 +16,44 @@ var (
 	JOB_REQUEST = JobRequest{
 		Script:   "test",
 		Nicename: "nice",
-		Options: map[string][]func([]byte) (string, error){
-			SCRIPT.Options[0].Name: []func([]byte) (string, error) {
-				func([]byte) (string, error) { return "file1.xml", nil },
-				func([]byte) (string, error) { return "file2.xml", nil },
+		Options: map[string][]func(bool) (string, error){
+			SCRIPT.Options[0].Name: []func(bool) (string, error) {
+				func(bool) (string, error) { return "file1.xml", nil },
+				func(bool) (string, error) { return "file2.xml", nil },
 			},
-			SCRIPT.Options[1].Name: []func([]byte) (string, error){
-				func([]byte) (string, error) { return "true", nil },
+			SCRIPT.Options[1].Name: []func(bool) (string, error){
+				func(bool) (string, error) { return "true", nil },
 			},
 		},
-		Inputs: map[string][]func([]byte) (url.URL, error){
-			SCRIPT.Inputs[0].Name: []func([]byte) (url.URL, error) {
-				func([]byte) (url.URL, error) { return url.URL{Opaque: "tmp/file.xml"}, nil },
-				func([]byte) (url.URL, error) { return url.URL{Opaque: "tmp/file1.xml"}, nil },
+		Inputs: map[string][]func(bool) (url.URL, error){
+			SCRIPT.Inputs[0].Name: []func(bool) (url.URL, error) {
+				func(bool) (url.URL, error) { return url.URL{Opaque: "tmp/file.xml"}, nil },
+				func(bool) (url.URL, error) { return url.URL{Opaque: "tmp/file1.xml"}, nil },
 			},
-			SCRIPT.Inputs[1].Name: []func([]byte) (url.URL, error) {
-				func([]byte) (url.URL, error) { return url.URL{Opaque: "tmp/file2.xml"}, nil },
+			SCRIPT.Inputs[1].Name: []func(bool) (url.URL, error) {
+				func(bool) (url.URL, error) { return url.URL{Opaque: "tmp/file2.xml"}, nil },
 			},
 		},
 	}
 	JOB_REQUEST_2 = JobRequest{
 		Script:   "test",
 		Nicename: "nice",
-		Options: map[string][]func([]byte) (string, error){
-			SCRIPT.Options[0].Name: []func([]byte) (string, error) {
-				func([]byte) (string, error) { return "file1.xml", nil },
-				func([]byte) (string, error) { return "file2.xml", nil },
+		Options: map[string][]func(bool) (string, error){
+			SCRIPT.Options[0].Name: []func(bool) (string, error) {
+				func(bool) (string, error) { return "file1.xml", nil },
+				func(bool) (string, error) { return "file2.xml", nil },
 			},
-			SCRIPT.Options[1].Name: []func([]byte) (string, error){
-				func([]byte) (string, error) { return "true", nil },
+			SCRIPT.Options[1].Name: []func(bool) (string, error){
+				func(bool) (string, error) { return "true", nil },
 			},
 		},
-		Inputs: map[string][]func([]byte) (url.URL, error){
-			SCRIPT.Inputs[0].Name: []func([]byte) (url.URL, error) {
-				func([]byte) (url.URL, error) { return url.URL{Opaque: "tmp/file.xml"}, nil },
-				func([]byte) (url.URL, error) { return url.URL{Opaque: "tmp/file1.xml"}, nil },
+		Inputs: map[string][]func(bool) (url.URL, error){
+			SCRIPT.Inputs[0].Name: []func(bool) (url.URL, error) {
+				func(bool) (url.URL, error) { return url.URL{Opaque: "tmp/file.xml"}, nil },
+				func(bool) (url.URL, error) { return url.URL{Opaque: "tmp/file1.xml"}, nil },
 			},
-			SCRIPT.Inputs[1].Name: []func([]byte) (url.URL, error) {
-				func([]byte) (url.URL, error) { return url.URL{Opaque: "tmp/file2.xml"}, nil },
+			SCRIPT.Inputs[1].Name: []func(bool) (url.URL, error) {
+				func(bool) (url.URL, error) { return url.URL{Opaque: "tmp/file2.xml"}, nil },
 			},
 		},
 	}
@@ -129,7 +132,7 @@ func TestNewLink(t *testing.T) {
 
 	link := NewLink(config)
 	{
-		res := link.pipeline.(*pipeline.Pipeline).BaseUrl
+		res := link.pipeline.(*streamingPipeline).BaseUrl
 		expected := "www.daisy.org:8888/ws/"
 		if res != expected {
 			t.Errorf("The url has not been properly set '%s'!='%s'", res, expected)
@@ -189,6 +192,9 @@ func TestCheckCredentials(t *testing.T) {
 		if err == nil {
 			t.Errorf("Credentials should've error'd")
 		}
+		if _, ok := err.(AuthError); !ok {
+			t.Errorf("Expected an auth error got %#v", err)
+		}
 	}
 	{
 		cnf := copyConf()
@@ -320,18 +326,18 @@ func TestJobRequestToPipeline(t *testing.T) {
 		}
 
 	}
-	input, _ := JOB_REQUEST_2.Inputs[req.Inputs[0].Name][0](nil)
+	input, _ := JOB_REQUEST_2.Inputs[req.Inputs[0].Name][0](false)
 	if (err != nil) {
 		t.Error("Unexpected error")
 	}
 	if req.Inputs[0].Items[0].Value != input.String() {
 		t.Errorf("JobRequest to pipeline failed \nexpected %v \nresult %v", input.String(), req.Inputs[0].Items[0].Value)
 	}
-	input, _ = JOB_REQUEST_2.Inputs[req.Inputs[0].Name][1](nil)
+	input, _ = JOB_REQUEST_2.Inputs[req.Inputs[0].Name][1](false)
 	if req.Inputs[0].Items[1].Value != input.String() {
 		t.Errorf("JobRequest to pipeline failed \nexpected %v \nresult %v", input.String(), req.Inputs[0].Items[1].Value)
 	}
-	input, _ = JOB_REQUEST_2.Inputs[req.Inputs[1].Name][0](nil)
+	input, _ = JOB_REQUEST_2.Inputs[req.Inputs[1].Name][0](false)
 	if req.Inputs[1].Items[0].Value != input.String() {
 		t.Errorf("JobRequest to pipeline failed \nexpected %v \nresult %v", input.String(), req.Inputs[1].Items[0].Value)
 	}
@@ -358,7 +364,7 @@ func TestJobRequestToPipeline(t *testing.T) {
 			t.Errorf("Len of options mismatch %v %v", name, len(reqOpts))
 		}
 		for idx, item := range opt.Items {
-			expected, _ := reqOpts[idx](nil)
+			expected, _ := reqOpts[idx](false)
 			if item.Value != expected {
 				t.Errorf("JobRequest to pipeline failed \nexpected %v \nresult %v", expected, item.Value)
 			}
@@ -371,17 +377,41 @@ func TestJobRequestToPipeline(t *testing.T) {
 		if len(opt.Items) != 0 {
 			t.Error("Simple option lenght !=0")
 		}
-		expected, _ := JOB_REQUEST_2.Options[name][0](nil)
+		expected, _ := JOB_REQUEST_2.Options[name][0](false)
 		if opt.Value != expected {
 			t.Errorf("JobRequest to pipeline failed \nexpected %v \nresult %v", expected, opt.Value)
 		}
 	}
 }
 
+//Makes the waits between polls return straight away moving a fake clock forward, the
+//last poll is forgotten afterwards
+func mockSleep() func() {
+	back, backClock := sleep, pollClock
+	mutex := sync.Mutex{}
+	now := time.Now()
+	pollClock = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	sleep = func(d time.Duration, done <-chan struct{}) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		now = now.Add(d)
+		return true
+	}
+	return func() {
+		sleep, pollClock = back, backClock
+		polls = &pollScheduler{}
+	}
+}
+
 func TestAsyncMessagesErr(t *testing.T) {
+	defer mockSleep()()
 	link := PipelineLink{pipeline: newPipelineTest(true)}
 	chMsg := make(chan Message)
-	go getAsyncMessages(link, "jobId", chMsg)
+	go getAsyncMessages(link, "jobId", chMsg, nil)
 	message := <-chMsg
 	if message.Error == nil {
 		t.Error("Expected error nil")
@@ -393,7 +423,7 @@ func TestAsyncMessages(t *testing.T) {
 	link := PipelineLink{pipeline: newPipelineTest(false)}
 	chMsg := make(chan Message)
 	var msgs []string
-	go getAsyncMessages(link, "jobId", chMsg)
+	go getAsyncMessages(link, "jobId", chMsg, nil)
 	for msg := range chMsg {
 		msgs = append(msgs, msg.Message)
 	}
@@ -408,6 +438,80 @@ func TestAsyncMessages(t *testing.T) {
 	}
 }
 
+func TestAsyncMessagesRetry(t *testing.T) {
+	defer mockSleep()()
+	pipe := newPipelineTest(false)
+	calls := 0
+	seqs := []int{}
+	pipe.job = func(id string, msgSeq int) (pipeline.Job, error) {
+		calls++
+		seqs = append(seqs, msgSeq)
+		switch calls {
+		case 1:
+			return JOB_1, nil
+		case 2, 3:
+			return JOB_1, &url.Error{Op: "Get", URL: "http://localhost:8181/ws/jobs/job1", Err: errors.New("connection refused")}
+		}
+		return JOB_2, nil
+	}
+	link := PipelineLink{pipeline: pipe, config: copyConf()}
+	chMsg := make(chan Message)
+	go getAsyncMessages(link, "job1", chMsg, nil)
+	var msgs []string
+	for msg := range chMsg {
+		if msg.Error != nil {
+			t.Fatalf("Unexpected error %v", msg.Error)
+		}
+		if msg.Message != "" {
+			msgs = append(msgs, msg.Message)
+		}
+	}
+	if len(msgs) != 3 || msgs[0] != "Message 1" || msgs[2] != "Message 3" {
+		t.Errorf("Messages lost or repeated while retrying %v", msgs)
+	}
+	expected := []int{-1, 2, 2, 2}
+	for idx, seq := range expected {
+		if seqs[idx] != seq {
+			t.Errorf("Poll %v: expected sequence %v got %v", idx, seq, seqs[idx])
+		}
+	}
+}
+
+func TestAsyncMessagesRetriesExhausted(t *testing.T) {
+	defer mockSleep()()
+	for errMsg, expected := range map[string]int{"Error": 3, pipeline.ERR_401: 1} {
+		pipe := newPipelineTest(false)
+		calls := 0
+		pipe.job = func(id string, msgSeq int) (pipeline.Job, error) {
+			calls++
+			return pipeline.Job{}, errors.New(errMsg)
+		}
+		config := copyConf()
+		config[POLLRETRIES] = 2
+		link := PipelineLink{pipeline: pipe, config: config}
+		chMsg := make(chan Message)
+		go getAsyncMessages(link, "job1", chMsg, nil)
+		if msg := <-chMsg; msg.Error == nil {
+			t.Errorf("Expected error")
+		}
+		if calls != expected {
+			t.Errorf("%v: expected %v polls got %v", errMsg, expected, calls)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt < 10; attempt++ {
+		max := RETRY_WAIT << uint(attempt-1)
+		if max > RETRY_MAX_WAIT {
+			max = RETRY_MAX_WAIT
+		}
+		if wait := backoff(attempt); wait < max/2 || wait > max {
+			t.Errorf("Attempt %v: wait %v out of [%v, %v]", attempt, wait, max/2, max)
+		}
+	}
+}
+
 func TestIsLocal(t *testing.T) {
 	link := PipelineLink{FsAllow: true}
 	if !link.IsLocal() {
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/bertfrees/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Names of the files written along with the results
+const (
+	JOB_LOG_FILE      = "job.log"
+	JOB_METADATA_FILE = "job.json"
+)
+
+//Files about the job to write along with its results
+type jobFiles struct {
+	log      bool
+	metadata bool
+}
+
+//Metadata of a finished job as written to job.json
+type jobMetadata struct {
+	Id        string                 `json:"id"`
+	Script    string                 `json:"script"`
+	Nicename  string                 `json:"nicename,omitempty"`
+	Priority  string                 `json:"priority,omitempty"`
+	Status    string                 `json:"status"`
+	Inputs    map[string][]string    `json:"inputs,omitempty"`
+	Options   map[string]interface{} `json:"options,omitempty"`
+	Submitted *time.Time             `json:"submitted,omitempty"`
+	Finished  *time.Time             `json:"finished,omitempty"`
+	Duration  string                 `json:"duration,omitempty"`
+	Messages  []metadataMessage      `json:"messages"`
+}
+
+type metadataMessage struct {
+	Sequence int    `json:"sequence"`
+	Level    string `json:"level"`
+	Depth    int    `json:"depth"`
+	Text     string `json:"text"`
+}
+
+//Adds the switches to write the job's log and metadata
+func addJobFilesOptions(cmd *subcommand.Command, files *jobFiles) {
+	cmd.AddSwitch("with-log", "", "Write the job's log to "+JOB_LOG_FILE+" in the output directory, or next to the zip file named after it (e.g. results.zip.log)", func(string, string) error {
+		files.log = true
+		return nil
+	})
+	cmd.AddSwitch("with-metadata", "", "Write the job's id, script, options, status, timings and messages to "+JOB_METADATA_FILE+" in the output directory, or next to the zip file named after it (e.g. results.zip.json)", func(string, string) error {
+		files.metadata = true
+		return nil
+	})
+}
+
+//Returns where the log and metadata are written: into the output directory, or next to
+//the zip file named after it so the files of several zipped jobs don't overwrite each other
+func (f jobFiles) paths(output string, zipped bool) (logPath, metadataPath string) {
+	if zipped {
+		return output + filepath.Ext(JOB_LOG_FILE), output + filepath.Ext(JOB_METADATA_FILE)
+	}
+	return filepath.Join(output, JOB_LOG_FILE), filepath.Join(output, JOB_METADATA_FILE)
+}
+
+//Writes the files into the output directory, or next to the zip file if the results are
+//zipped. The timings are left out when they are not known
+func (f jobFiles) store(link PipelineLink, jobId, output string, zipped bool, submitted, finished time.Time) error {
+	if !f.log && !f.metadata {
+		return nil
+	}
+	dir := output
+	if zipped {
+		dir = filepath.Dir(output)
+	}
+	if err := mkdir(dir); err != nil {
+		return err
+	}
+	logPath, metadataPath := f.paths(output, zipped)
+	if f.log {
+		data, err := link.Log(jobId)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(logPath, data, 0644); err != nil {
+			return err
+		}
+	}
+	if f.metadata {
+		job, err := link.Job(jobId)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(newJobMetadata(job, submitted, finished), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(metadataPath, append(data, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newJobMetadata(job pipeline.Job, submitted, finished time.Time) jobMetadata {
+	meta := jobMetadata{
+		Id:       job.Id,
+		Script:   job.Script.Id,
+		Nicename: job.Nicename,
+		Priority: job.Priority,
+		Status:   job.Status,
+		Inputs:   map[string][]string{},
+		Options:  map[string]interface{}{},
+		Messages: []metadataMessage{},
+	}
+	for _, input := range job.Script.Inputs {
+		for _, item := range input.Items {
+			meta.Inputs[input.Name] = append(meta.Inputs[input.Name], item.Value)
+		}
+	}
+	for _, option := range job.Script.Options {
+		if len(option.Items) == 0 {
+			meta.Options[option.Name] = option.Value
+			continue
+		}
+		items := []string{}
+		for _, item := range option.Items {
+			items = append(items, item.Value)
+		}
+		meta.Options[option.Name] = items
+	}
+	if !submitted.IsZero() {
+		meta.Submitted = &submitted
+	}
+	if !finished.IsZero() {
+		meta.Finished = &finished
+	}
+	if meta.Submitted != nil && meta.Finished != nil {
+		meta.Duration = finished.Sub(submitted).Round(time.Millisecond).String()
+	}
+	messages := make(chan Message)
+	go func() {
+		flattenMessages(job.Messages.Message, messages, job.Status, job.Messages.Progress, 0, 0)
+		close(messages)
+	}()
+	for msg := range messages {
+		meta.Messages = append(meta.Messages, metadataMessage{
+			Sequence: msg.Sequence,
+			Level:    msg.Level,
+			Depth:    msg.Depth,
+			Text:     msg.Message,
+		})
+	}
+	return meta
+}
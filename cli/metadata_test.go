@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func TestNewJobMetadata(t *testing.T) {
+	job := RERUN_JOB
+	job.Messages = pipeline.Messages{Message: []pipeline.Message{
+		pipeline.Message{Sequence: 1, Level: "INFO", Content: "Converting", Message: []pipeline.Message{
+			pipeline.Message{Sequence: 2, Level: "WARNING", Content: "Missing title"},
+		}},
+	}}
+	submitted := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	meta := newJobMetadata(job, submitted, submitted.Add(90*time.Second))
+	if meta.Id != "job1" || meta.Script != "test" || meta.Status != "FAIL" || meta.Priority != "low" {
+		t.Errorf("Wrong job fields %+v", meta)
+	}
+	if len(meta.Inputs["source"]) != 2 || meta.Options["another-opt"] != "foo" {
+		t.Errorf("Wrong inputs and options %v %v", meta.Inputs, meta.Options)
+	}
+	if meta.Duration != "1m30s" {
+		t.Errorf("Wrong duration %v", meta.Duration)
+	}
+	if len(meta.Messages) != 2 || meta.Messages[1].Depth != 1 || meta.Messages[1].Text != "Missing title" {
+		t.Errorf("Wrong messages %+v", meta.Messages)
+	}
+	meta = newJobMetadata(job, time.Time{}, time.Time{})
+	if meta.Submitted != nil || meta.Duration != "" {
+		t.Errorf("Unknown timings were written %+v", meta)
+	}
+}
+
+func TestJobFilesStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	pipe := newPipelineTest(false)
+	pipe.val = []byte("the log")
+	pipe.job = func(string, int) (pipeline.Job, error) {
+		return RERUN_JOB, nil
+	}
+	link := PipelineLink{pipeline: pipe}
+	output := filepath.Join(dir, "results.zip")
+	if err := (jobFiles{log: true, metadata: true}).store(link, "job1", output, true, time.Now(), time.Now()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	log, err := ioutil.ReadFile(output + ".log")
+	if err != nil || string(log) != "the log" {
+		t.Errorf("Log not written %q %v", log, err)
+	}
+	data, err := ioutil.ReadFile(output + ".json")
+	if err != nil {
+		t.Fatalf("Metadata not written %v", err)
+	}
+	meta := jobMetadata{}
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Id != "job1" {
+		t.Errorf("Wrong metadata %v %+v", err, meta)
+	}
+	//another zip in the same folder has its own files
+	pipe.val = []byte("another log")
+	if err := (jobFiles{log: true}).store(link, "job2", filepath.Join(dir, "other.zip"), true, time.Now(), time.Now()); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if log, _ := ioutil.ReadFile(output + ".log"); string(log) != "the log" {
+		t.Errorf("Log overwritten %q", log)
+	}
+}
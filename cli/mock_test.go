@@ -95,8 +95,11 @@ type PipelineTest struct {
 	key            string
 	secret         string
 	withScripts    bool
+	requested      bool
+	jobRequest     pipeline.JobRequest
 	jobs           func() (pipeline.Jobs, error)
 	delete         func(string) (bool, error)
+	job            func(string, int) (pipeline.Job, error)
 }
 
 func (p PipelineTest) mockCall() (val interface{}, err error) {
@@ -173,6 +176,9 @@ func (p *PipelineTest) ScriptUrl(id string) string {
 }
 
 func (p *PipelineTest) Job(id string, msgSeq int) (job pipeline.Job, err error) {
+	if p.job != nil {
+		return p.job(id, msgSeq)
+	}
 	p.call = JOB_CALL
 	_, err = p.mockCall()
 	if err != nil {
@@ -191,6 +197,8 @@ func (p *PipelineTest) Job(id string, msgSeq int) (job pipeline.Job, err error)
 }
 
 func (p *PipelineTest) JobRequest(newJob pipeline.JobRequest, data []byte) (job pipeline.Job, err error) {
+	p.requested = true
+	p.jobRequest = newJob
 	return
 }
 
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bertfrees/go-subcommand"
+)
+
+//Policies for an output that already exists
+const (
+	IF_EXISTS_FAIL      = "fail"      //don't store the results
+	IF_EXISTS_OVERWRITE = "overwrite" //replace the output once the results are stored
+	IF_EXISTS_MERGE     = "merge"     //write into the existing folder or over the existing zip
+	IF_EXISTS_RENAME    = "rename"    //store the results next to it adding a numeric suffix
+)
+
+var ifExistsPolicies = []string{IF_EXISTS_FAIL, IF_EXISTS_OVERWRITE, IF_EXISTS_MERGE, IF_EXISTS_RENAME}
+
+//Where the results are written. When an existing output is overwritten the results are
+//written into a sibling path which replaces the output once they are complete
+type outputTarget struct {
+	path  string //where the results are written
+	final string //where the results end up
+}
+
+//Adds the option to choose what to do when the output already exists
+func addIfExistsOption(cmd *subcommand.Command, policy *string) {
+	cmd.AddOption("if-exists", "", "What to do when the output already exists: "+strings.Join(ifExistsPolicies, ", ")+" (by default the "+IFEXISTS+" configuration)", "", "POLICY", func(name, value string) error {
+		if !contains(ifExistsPolicies, value) {
+			return ValidationError{fmt.Errorf("%s is not a valid value for --%s. Allowed values are %s", value, name, strings.Join(ifExistsPolicies, ", "))}
+		}
+		*policy = value
+		return nil
+	})
+}
+
+//Returns the policy given in the command line or, if none, the configured one
+func ifExistsPolicy(policy string, conf Config) (string, error) {
+	if policy != "" {
+		return policy, nil
+	}
+	policy, ok := conf[IFEXISTS].(string)
+	if !ok || policy == "" {
+		return config[IFEXISTS].(string), nil
+	}
+	if !contains(ifExistsPolicies, policy) {
+		return "", ValidationError{fmt.Errorf("%s is not a valid value for %s. Allowed values are %s", policy, IFEXISTS, strings.Join(ifExistsPolicies, ", "))}
+	}
+	return policy, nil
+}
+
+//Checks that the results can be stored into output following the policy
+func checkOutput(output, policy string) error {
+	if _, err := os.Stat(output); err == nil && policy == IF_EXISTS_FAIL {
+		return ValidationError{fmt.Errorf("%v already exists, use --if-exists to overwrite, merge or rename it", output)}
+	}
+	return nil
+}
+
+//Returns where the results are written following the policy
+func newOutputTarget(output string, zipped bool, policy string) (target outputTarget, err error) {
+	target = outputTarget{path: output, final: output}
+	if err = checkOutput(output, policy); err != nil {
+		return
+	}
+	if _, statErr := os.Stat(output); statErr != nil {
+		return
+	}
+	switch policy {
+	case IF_EXISTS_RENAME:
+		target.path = renamedOutput(output, zipped)
+		target.final = target.path
+	case IF_EXISTS_OVERWRITE:
+		target.path, err = siblingPath(output, zipped)
+	}
+	return
+}
+
+//Returns where the job's log and metadata go when there are no results to store
+func filesOutput(output string, zipped bool, policy string) string {
+	if _, err := os.Stat(output); err == nil && policy == IF_EXISTS_RENAME {
+		return renamedOutput(output, zipped)
+	}
+	return output
+}
+
+//Adds the first free numeric suffix to the output, before the extension of zip files
+func renamedOutput(output string, zipped bool) string {
+	base, ext := strings.TrimRight(output, `/\`), ""
+	if zipped {
+		ext = filepath.Ext(base)
+		base = strings.TrimSuffix(base, ext)
+	}
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%v-%v%v", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+//Creates a temporary file or folder in the same folder as path so it can be renamed into it
+func siblingPath(path string, file bool) (string, error) {
+	path = strings.TrimRight(path, `/\`)
+	prefix := "." + filepath.Base(path) + "-"
+	if file {
+		f, err := ioutil.TempFile(filepath.Dir(path), prefix)
+		if err != nil {
+			return "", err
+		}
+		return f.Name(), f.Close()
+	}
+	return ioutil.TempDir(filepath.Dir(path), prefix)
+}
+
+//Puts the results in their final place, replacing the existing output
+func (t outputTarget) commit() error {
+	if t.path == t.final {
+		return nil
+	}
+	info, err := os.Stat(t.path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		//files are replaced atomically
+		return os.Rename(t.path, t.final)
+	}
+	old, err := siblingPath(t.final, false)
+	if err != nil {
+		return err
+	}
+	//the empty folder only reserved the name
+	if err := os.Remove(old); err != nil {
+		return err
+	}
+	if err := os.Rename(t.final, old); err != nil {
+		return err
+	}
+	if err := os.Rename(t.path, t.final); err != nil {
+		os.Rename(old, t.final)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+//Removes the results written when they don't replace the output
+func (t outputTarget) discard() error {
+	if t.path == t.final {
+		return nil
+	}
+	return os.RemoveAll(t.path)
+}
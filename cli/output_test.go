@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//Creates an output folder with a file left by a previous run
+func existingOutput(t *testing.T) (dir, output string) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	output = filepath.Join(dir, "out")
+	if err := os.MkdirAll(output, 0755); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(output, "old.txt"), []byte("old"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return dir, output
+}
+
+func runResults(t *testing.T, args ...string) error {
+	cli, link, _ := makeReturningCli(createResultsZip(t), t)
+	AddResultsCommand(cli, link)
+	overrideOutput(cli)
+	return cli.Run(append([]string{"results"}, args...))
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestIfExistsMerge(t *testing.T) {
+	dir, output := existingOutput(t)
+	defer os.RemoveAll(dir)
+	if err := runResults(t, "-o", output, "job1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !exists(filepath.Join(output, "old.txt")) || !exists(filepath.Join(output, "result", "book.epub")) {
+		t.Errorf("Results not merged into the existing output")
+	}
+}
+
+func TestIfExistsFail(t *testing.T) {
+	dir, output := existingOutput(t)
+	defer os.RemoveAll(dir)
+	err := runResults(t, "-o", output, "--if-exists", IF_EXISTS_FAIL, "job1")
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("Expected a validation error got %#v", err)
+	}
+	if exists(filepath.Join(output, "result")) {
+		t.Errorf("Results stored into the existing output")
+	}
+	if err := runResults(t, "-o", output, "--if-exists", "ignore", "job1"); err == nil {
+		t.Errorf("Invalid policy didn't error")
+	}
+}
+
+func TestIfExistsOverwrite(t *testing.T) {
+	dir, output := existingOutput(t)
+	defer os.RemoveAll(dir)
+	if err := runResults(t, "-o", output, "--if-exists", IF_EXISTS_OVERWRITE, "job1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if exists(filepath.Join(output, "old.txt")) || !exists(filepath.Join(output, "result", "book.epub")) {
+		t.Errorf("Existing output not replaced")
+	}
+	//the temporary folders are gone
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Wrong entries %v", entries)
+	}
+}
+
+func TestIfExistsRename(t *testing.T) {
+	dir, output := existingOutput(t)
+	defer os.RemoveAll(dir)
+	if err := runResults(t, "-o", output, "--if-exists", IF_EXISTS_RENAME, "job1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !exists(filepath.Join(output, "old.txt")) || exists(filepath.Join(output, "result")) {
+		t.Errorf("Existing output modified")
+	}
+	if !exists(filepath.Join(output+"-1", "result", "book.epub")) {
+		t.Errorf("Results not stored into the renamed output")
+	}
+	if renamed := renamedOutput(filepath.Join(dir, "results.zip"), true); renamed != filepath.Join(dir, "results-1.zip") {
+		t.Errorf("Wrong renamed zip %v", renamed)
+	}
+}
+
+func TestIfExistsConfig(t *testing.T) {
+	policy, err := ifExistsPolicy("", Config{IFEXISTS: IF_EXISTS_RENAME})
+	if err != nil || policy != IF_EXISTS_RENAME {
+		t.Errorf("Configured policy not used %v %v", policy, err)
+	}
+	if policy, _ := ifExistsPolicy(IF_EXISTS_FAIL, Config{IFEXISTS: IF_EXISTS_RENAME}); policy != IF_EXISTS_FAIL {
+		t.Errorf("Flag doesn't override the configuration")
+	}
+	if _, err := ifExistsPolicy("", Config{IFEXISTS: "ignore"}); err == nil {
+		t.Errorf("Invalid configured policy didn't error")
+	}
+}
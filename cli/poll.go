@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+//Spaces the polls of all the jobs followed by dp2 so the requests to the webservice stay
+//bounded whatever the number of jobs. Only the polls actually sent are spaced, a job
+//waiting longer doesn't hold back the others
+type pollScheduler struct {
+	mutex sync.Mutex
+	last  time.Time //when the last poll of any job was let through
+}
+
+//Shared by all the followers
+var polls = &pollScheduler{}
+
+//Current time as seen by the scheduler (mockable for testing)
+var pollClock = time.Now
+
+//Waits for the given interval and then until at least spacing passed since the last poll
+//let through. Returns false if done was closed while waiting
+func (s *pollScheduler) wait(interval, spacing time.Duration, done <-chan struct{}) bool {
+	if !sleep(interval, done) {
+		return false
+	}
+	for {
+		s.mutex.Lock()
+		now := pollClock()
+		at := s.last.Add(spacing)
+		if !now.Before(at) {
+			s.last = now
+			s.mutex.Unlock()
+			return true
+		}
+		s.mutex.Unlock()
+		if !sleep(at.Sub(now), done) {
+			return false
+		}
+	}
+}
+
+//Interval between the polls of a single job: it starts at min and doubles up to max while
+//the job shows no activity
+type pollInterval struct {
+	min, max time.Duration
+	current  time.Duration
+}
+
+//Creates the interval out of the poll_min_interval and poll_max_interval configuration,
+//the default values are used for the invalid ones
+func newPollInterval(c Config) *pollInterval {
+	min, err := c.durationValue(POLLMIN)
+	if err != nil || min <= 0 {
+		log.Printf("Using the default %v: %v", POLLMIN, err)
+		min, _ = config.durationValue(POLLMIN)
+	}
+	max, err := c.durationValue(POLLMAX)
+	if err != nil || max <= 0 {
+		log.Printf("Using the default %v: %v", POLLMAX, err)
+		max, _ = config.durationValue(POLLMAX)
+	}
+	if max < min {
+		max = min
+	}
+	return &pollInterval{min: min, max: max, current: min}
+}
+
+//Returns the interval before the next poll, which is reset when the last one brought news
+func (i *pollInterval) next(activity bool) time.Duration {
+	if activity {
+		i.current = i.min
+		return i.current
+	}
+	i.current *= 2
+	if i.current > i.max {
+		i.current = i.max
+	}
+	return i.current
+}
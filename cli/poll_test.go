@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPollInterval(t *testing.T) {
+	config := copyConf()
+	config[POLLMIN] = "1s"
+	config[POLLMAX] = "5s"
+	interval := newPollInterval(config)
+	expected := []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for idx, exp := range expected {
+		if res := interval.next(false); res != exp {
+			t.Errorf("Poll %v without activity: expected %v got %v", idx, exp, res)
+		}
+	}
+	if res := interval.next(true); res != time.Second {
+		t.Errorf("Activity didn't reset the interval %v", res)
+	}
+}
+
+func TestPollIntervalInvalid(t *testing.T) {
+	config := copyConf()
+	config[POLLMIN] = "often"
+	config[POLLMAX] = "100ms"
+	interval := newPollInterval(config)
+	if interval.min != 500*time.Millisecond {
+		t.Errorf("Invalid minimum didn't fall back to the default %v", interval.min)
+	}
+	if interval.max != interval.min {
+		t.Errorf("Maximum lower than the minimum %v < %v", interval.max, interval.min)
+	}
+}
+
+func TestPollSchedulerSpacing(t *testing.T) {
+	defer mockSleep()()
+	issued := []time.Time{}
+	for i := 0; i < 3; i++ {
+		polls.wait(0, time.Second, nil)
+		issued = append(issued, pollClock())
+	}
+	for idx := 1; idx < len(issued); idx++ {
+		if gap := issued[idx].Sub(issued[idx-1]); gap != time.Second {
+			t.Errorf("Poll %v: expected a gap of 1s got %v", idx, gap)
+		}
+	}
+	//the gap counts from the last poll, not from when the wait started
+	polls.wait(5*time.Second, time.Second, nil)
+	if gap := pollClock().Sub(issued[2]); gap != 5*time.Second {
+		t.Errorf("Expected a gap of 5s got %v", gap)
+	}
+}
+
+//A job waiting long doesn't delay the polls of the others
+func TestPollSchedulerMixedWaits(t *testing.T) {
+	back := polls
+	defer func() {
+		polls = back
+	}()
+	polls = &pollScheduler{}
+	done := make(chan struct{})
+	slow := make(chan bool)
+	go func() {
+		slow <- polls.wait(10*time.Second, 10*time.Millisecond, done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	polls.wait(0, 10*time.Millisecond, nil)
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("The short wait was held back by the long one: %v", waited)
+	}
+	close(done)
+	if <-slow {
+		t.Errorf("The long wait wasn't cancelled")
+	}
+}
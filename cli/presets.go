@@ -0,0 +1,435 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bertfrees/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+	"launchpad.net/goyaml"
+)
+
+const (
+	PresetListTemplate = `Preset		Script
+{{range .}}{{.Name}}	{{.Script}}
+{{end}}`
+
+	PresetTemplate = `Preset: {{.Name}}
+Script: {{.Script}}
+{{if .Inputs}}Inputs:
+{{range $name, $value := .Inputs}}	--{{$name}} {{$value}}
+{{end}}{{end}}{{if .Options}}Options:
+{{range $name, $value := .Options}}	--{{$name}} {{$value}}
+{{end}}{{end}}{{if .Parameters}}Stylesheet parameters:
+{{range $name, $value := .Parameters}}	--{{$name}} {{$value}}
+{{end}}{{end}}{{if .Flags}}Flags:
+{{range $name, $value := .Flags}}	--{{$name}} {{$value}}
+{{end}}{{end}}`
+
+	presetUsage = "(save NAME SCRIPT [OPTIONS]|run NAME [OPTIONS]|list|show NAME|delete NAME)"
+)
+
+//File where the presets are stored
+var PresetsPath = filepath.Join(filepath.Dir(LastIdPath), "presets.yml")
+
+//Flags of every script taking comma separated lists, which may be repeated
+var listFlags = []string{"port", "include", "exclude", "data-exclude"}
+
+//Script invocation saved under a name. The values are indexed by flag name (without dashes)
+//and written as they would be in the command line, switches have the value true
+type preset struct {
+	Name       string            `yaml:"-"`
+	Script     string            `yaml:"script"`
+	Inputs     map[string]string `yaml:"inputs,omitempty"`
+	Options    map[string]string `yaml:"options,omitempty"`
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+	Flags      map[string]string `yaml:"flags,omitempty"`
+}
+
+//Flags of a script command, against which presets are checked
+type scriptDefinition struct {
+	script pipeline.Script
+	flags  []subcommand.Flag
+	params []pipeline.StylesheetParameter
+}
+
+//Adds the preset command to save script invocations and run them later
+func AddPresetCommand(cli *Cli, link *PipelineLink) {
+	//the script flags are left to the preset actions, the parser only gets ACTION NAME
+	cli.AddRawCommand("preset", "Saves script invocations under a name and runs them", 2, func(command string, args ...string) error {
+		raw := cli.RawArgs()
+		switch {
+		case len(args) == 1 && args[0] == "list" && len(raw) == 0:
+			return listPresets(cli)
+		case len(args) == 2 && args[0] == "show" && len(raw) == 0:
+			return showPreset(cli, args[1])
+		case len(args) == 2 && args[0] == "delete" && len(raw) == 0:
+			return deletePreset(cli, args[1])
+		case len(args) == 2 && args[0] == "save" && len(raw) > 0:
+			return savePreset(cli, link, args[1], raw[0], raw[1:])
+		case len(args) == 2 && args[0] == "run":
+			return runPreset(cli, link, args[1], raw)
+		}
+		return ValidationError{fmt.Errorf("Usage: %v %v", command, presetUsage)}
+	}).SetArity(-1, presetUsage)
+}
+
+//Stores the script invocation described by args under the given name, replacing
+//the preset with the same name
+func savePreset(cli *Cli, link *PipelineLink, name, scriptId string, args []string) error {
+	def, err := newScriptDefinition(link, scriptId)
+	if err != nil {
+		return err
+	}
+	p, err := newPreset(def, args)
+	if err != nil {
+		return err
+	}
+	if err := p.validate(def); err != nil {
+		return err
+	}
+	presets, err := loadPresets()
+	if err != nil {
+		return err
+	}
+	presets[name] = p
+	if err := storePresets(presets); err != nil {
+		return err
+	}
+	cli.Printf("Preset %v saved\n", name)
+	return nil
+}
+
+//Runs the script of the preset with its values, the flags in overrides replace
+//the ones of the preset
+func runPreset(cli *Cli, link *PipelineLink, name string, overrides []string) error {
+	p, err := findPreset(name)
+	if err != nil {
+		return err
+	}
+	def, err := newScriptDefinition(link, p.Script)
+	if err != nil {
+		return err
+	}
+	if err := p.validate(def); err != nil {
+		return err
+	}
+	overridden, err := readFlags(def, overrides)
+	if err != nil {
+		return ValidationError{err}
+	}
+	jExec, err := parseScriptArgs(def.script, link, append(p.args(def, overridden), overrides...))
+	if err != nil {
+		return ValidationError{err}
+	}
+	return jExec.run(cli.Output)
+}
+
+func listPresets(cli *Cli) error {
+	presets, err := loadPresets()
+	if err != nil {
+		return err
+	}
+	list := []preset{}
+	for _, p := range presets {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return newCommandBuilder("preset", "").withTemplate(PresetListTemplate).writeOutput(list, cli)
+}
+
+func showPreset(cli *Cli, name string) error {
+	p, err := findPreset(name)
+	if err != nil {
+		return err
+	}
+	return newCommandBuilder("preset", "").withTemplate(PresetTemplate).writeOutput(p, cli)
+}
+
+func deletePreset(cli *Cli, name string) error {
+	presets, err := loadPresets()
+	if err != nil {
+		return err
+	}
+	if _, ok := presets[name]; !ok {
+		return ValidationError{fmt.Errorf("Preset %v not found", name)}
+	}
+	delete(presets, name)
+	if err := storePresets(presets); err != nil {
+		return err
+	}
+	cli.Printf("Preset %v deleted\n", name)
+	return nil
+}
+
+//Gets the script from the webservice along with its flags and stylesheet parameters
+func newScriptDefinition(link *PipelineLink, scriptId string) (def scriptDefinition, err error) {
+	if def.script, err = link.Script(scriptId); err != nil {
+		return def, linkError(err)
+	}
+	parser, _, err := newScriptParser(def.script, link)
+	if err != nil {
+		return def, linkError(err)
+	}
+	def.flags = parser.Commands[def.script.Id].Flags()
+	if def.params, err = scriptStylesheetParameters(def.script, link); err != nil {
+		return def, linkError(err)
+	}
+	return def, nil
+}
+
+//Returns the flag matching the command line argument (--long or -short)
+func (d scriptDefinition) flag(arg string) (subcommand.Flag, bool) {
+	return findFlag(d.flags, arg)
+}
+
+func (d scriptDefinition) option(name string) *pipeline.Option {
+	for idx, option := range d.script.Options {
+		if name == option.Name || name == "x-"+option.Name {
+			return &d.script.Options[idx]
+		}
+	}
+	return nil
+}
+
+func (d scriptDefinition) input(name string) bool {
+	for _, input := range d.script.Inputs {
+		if name == input.Name || name == "i-"+input.Name {
+			return true
+		}
+	}
+	return false
+}
+
+//Checks if the option or stylesheet parameter takes files or directories
+func (d scriptDefinition) path(name string) bool {
+	var dataType pipeline.DataType
+	if option := d.option(name); option != nil {
+		dataType = option.Type
+	} else if param := d.param(name); param != nil {
+		dataType = param.Type
+	}
+	switch dataType.(type) {
+	case pipeline.AnyFileURI, pipeline.AnyDirURI:
+		return true
+	}
+	return false
+}
+
+//Checks if the flag takes several values
+func (d scriptDefinition) sequence(name string) bool {
+	for _, input := range d.script.Inputs {
+		if name == input.Name || name == "i-"+input.Name {
+			return input.Sequence
+		}
+	}
+	if option := d.option(name); option != nil {
+		return option.Sequence
+	}
+	return contains(listFlags, name)
+}
+
+func (d scriptDefinition) param(name string) *pipeline.StylesheetParameter {
+	for idx, param := range d.params {
+		if name == param.Name || name == "x-"+param.Name {
+			return &d.params[idx]
+		}
+	}
+	return nil
+}
+
+//Reads the script flags in args into their values indexed by long name. Repeated sequences
+//are joined by commas, as they are written, other flags can only be given once
+func readFlags(def scriptDefinition, args []string) (map[string]string, error) {
+	values := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		flag, ok := def.flag(args[i])
+		if !ok {
+			return nil, fmt.Errorf("%v is not a flag of %v", args[i], def.script.Id)
+		}
+		value := "true"
+		if flag.Type == subcommand.Option {
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("No value given for --%v", flag.Long)
+			}
+			i++
+			value = args[i]
+		}
+		if prev, ok := values[flag.Long]; ok && flag.Type == subcommand.Option {
+			if !def.sequence(flag.Long) {
+				return nil, fmt.Errorf("--%v can only be given once", flag.Long)
+			}
+			value = prev + "," + value
+		}
+		values[flag.Long] = value
+	}
+	return values, nil
+}
+
+//Creates the preset out of the script flags in args
+func newPreset(def scriptDefinition, args []string) (p preset, err error) {
+	values, err := readFlags(def, args)
+	if err != nil {
+		return p, ValidationError{err}
+	}
+	p = preset{
+		Script:     def.script.Id,
+		Inputs:     map[string]string{},
+		Options:    map[string]string{},
+		Parameters: map[string]string{},
+		Flags:      map[string]string{},
+	}
+	for name, value := range values {
+		//local files are found wherever the preset is run from, the paths within the
+		//data are kept as they are
+		if name == "data" || values["data"] == "" && (def.input(name) || def.path(name)) {
+			if value, err = absolutePaths(value); err != nil {
+				return p, ValidationError{err}
+			}
+		}
+		switch {
+		case contains(commonFlags, "--"+name) || name == "data" || name == "data-exclude":
+			p.Flags[name] = value
+		case def.input(name):
+			p.Inputs[name] = value
+		case def.option(name) != nil:
+			p.Options[name] = value
+		default:
+			p.Parameters[name] = value
+		}
+	}
+	return p, nil
+}
+
+//Checks the preset against the current definition of its script: its flags must still
+//exist and the values of its options and stylesheet parameters must be valid
+func (p preset) validate(def scriptDefinition) error {
+	if _, err := readFlags(def, p.args(def, nil)); err != nil {
+		return ValidationError{fmt.Errorf("Preset %v is no longer valid: %v", p.Name, err)}
+	}
+	remote := p.Flags["data"] != ""
+	for _, name := range sortedNames(p.Options) {
+		option := def.option(name)
+		if option == nil {
+			return ValidationError{fmt.Errorf("Preset %v is no longer valid: --%v is not an option of %v", p.Name, name, def.script.Id)}
+		}
+		values := []string{p.Options[name]}
+		if option.Sequence {
+			values = strings.Split(p.Options[name], ",")
+		}
+		for _, value := range values {
+			if _, err := validateOption(value, option.Type, remote); err != nil {
+				return ValidationError{validationError(name, value, err)}
+			}
+		}
+	}
+	for _, name := range sortedNames(p.Parameters) {
+		param := def.param(name)
+		if param == nil {
+			return ValidationError{fmt.Errorf("Preset %v is no longer valid: --%v is not a stylesheet parameter of %v", p.Name, name, def.script.Id)}
+		}
+		if _, err := validateOption(p.Parameters[name], param.Type, remote); err != nil {
+			return ValidationError{validationError(name, p.Parameters[name], err)}
+		}
+	}
+	return nil
+}
+
+//Returns the preset values as script flags, leaving out the overridden ones
+func (p preset) args(def scriptDefinition, overridden map[string]string) []string {
+	values := map[string]string{}
+	for _, group := range []map[string]string{p.Inputs, p.Options, p.Parameters, p.Flags} {
+		for name, value := range group {
+			values[name] = value
+		}
+	}
+	args := []string{}
+	for _, name := range sortedNames(values) {
+		if _, ok := overridden[name]; ok {
+			continue
+		}
+		if flag, ok := def.flag("--" + name); ok && flag.Type == subcommand.Switch {
+			if values[name] == "true" {
+				args = append(args, "--"+name)
+			}
+			continue
+		}
+		args = append(args, "--"+name, values[name])
+	}
+	return args
+}
+
+//Makes the comma separated paths absolute, URIs are left as they are
+func absolutePaths(value string) (string, error) {
+	paths := strings.Split(value, ",")
+	for idx, path := range paths {
+		//a single letter is a windows drive
+		if u, err := url.Parse(path); err == nil && len(u.Scheme) > 1 {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return "", err
+		}
+		paths[idx] = abs
+	}
+	return strings.Join(paths, ","), nil
+}
+
+//Returns the keys sorted so presets are listed and replayed in a stable order
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func findPreset(name string) (preset, error) {
+	presets, err := loadPresets()
+	if err != nil {
+		return preset{}, err
+	}
+	p, ok := presets[name]
+	if !ok {
+		return p, ValidationError{fmt.Errorf("Preset %v not found", name)}
+	}
+	return p, nil
+}
+
+//Loads the presets file, no presets are returned when it doesn't exist yet
+func loadPresets() (map[string]preset, error) {
+	presets := map[string]preset{}
+	bytes, err := ioutil.ReadFile(PresetsPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return presets, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := goyaml.Unmarshal(bytes, &presets); err != nil {
+		return nil, fmt.Errorf("Error reading %v: %v", PresetsPath, err)
+	}
+	for name, p := range presets {
+		p.Name = name
+		presets[name] = p
+	}
+	return presets, nil
+}
+
+func storePresets(presets map[string]preset) error {
+	bytes, err := goyaml.Marshal(presets)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(PresetsPath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(PresetsPath, bytes, 0644)
+}
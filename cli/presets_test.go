@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Points the presets and last id files to a temporary dir and creates a source file in it
+func presetsDir(t *testing.T) (dir, source string, restore func()) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	source = filepath.Join(dir, "source.xml")
+	if err := ioutil.WriteFile(source, []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	presetsPath, lastIdPath := PresetsPath, LastIdPath
+	PresetsPath = filepath.Join(dir, "presets.yml")
+	LastIdPath = filepath.Join(dir, "lastid")
+	return dir, source, func() {
+		PresetsPath, LastIdPath = presetsPath, lastIdPath
+		os.RemoveAll(dir)
+	}
+}
+
+func makePresetCli(t *testing.T) *Cli {
+	link := &PipelineLink{FsAllow: true, pipeline: newPipelineTest(false)}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddPresetCommand(cli, link)
+	return cli
+}
+
+func TestPresetSaveRun(t *testing.T) {
+	defer mockSleep()()
+	dir, source, restore := presetsDir(t)
+	defer restore()
+	cli := makePresetCli(t)
+	err := cli.Run([]string{"preset", "save", "conv", "test", "--source", source, "--single", source,
+		"--test-opt", source, "--another-opt", "foo", "-o", filepath.Join(dir, "out"), "--zip"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	presets, err := loadPresets()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	p := presets["conv"]
+	if p.Name != "conv" || p.Script != "test" {
+		t.Errorf("Wrong preset %+v", p)
+	}
+	if p.Inputs["source"] != source || p.Options["another-opt"] != "foo" {
+		t.Errorf("Inputs and options not stored %+v", p)
+	}
+	if p.Flags["output"] != filepath.Join(dir, "out") || p.Flags["zip"] != "true" {
+		t.Errorf("Common flags not stored %+v", p)
+	}
+	if err := cli.Run([]string{"preset", "run", "conv", "--another-opt", "bar"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	//the override is validated instead of the stored value
+	if err := cli.Run([]string{"preset", "run", "conv", "--another-opt", "baz"}); err == nil {
+		t.Errorf("Invalid override didn't error")
+	}
+}
+
+//Relative paths given when saving still point to the same files when run from elsewhere
+func TestPresetRunElsewhere(t *testing.T) {
+	defer mockSleep()()
+	dir, _, restore := presetsDir(t)
+	defer restore()
+	back := SCRIPT.Options[0].Type
+	defer func() {
+		SCRIPT.Options[0].Type = back
+	}()
+	SCRIPT.Options[0].Type = pipeline.AnyFileURI{}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err = makePresetCli(t).Run([]string{"preset", "save", "conv", "test", "--source", "source.xml", "--single", "source.xml",
+		"--test-opt", "source.xml", "-o", filepath.Join(dir, "out")})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	presets, err := loadPresets()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	source := filepath.Join(dir, "source.xml")
+	if p := presets["conv"]; p.Inputs["source"] != source || p.Options["test-opt"] != source {
+		t.Errorf("Paths not stored as absolute paths %+v", p)
+	}
+	elsewhere := filepath.Join(dir, "elsewhere")
+	if err := os.Mkdir(elsewhere, 0755); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := os.Chdir(elsewhere); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := makePresetCli(t).Run([]string{"preset", "run", "conv"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestPresetSaveInvalid(t *testing.T) {
+	_, source, restore := presetsDir(t)
+	defer restore()
+	cli := makePresetCli(t)
+	err := cli.Run([]string{"preset", "save", "conv", "test", "--test-opt", source, "--another-opt", "baz"})
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("Expected a validation error got %#v", err)
+	}
+	err = cli.Run([]string{"preset", "save", "conv", "test", "--not-an-option", "value"})
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("Expected a validation error got %#v", err)
+	}
+	if _, err := os.Stat(PresetsPath); err == nil {
+		t.Errorf("Invalid presets were stored")
+	}
+}
+
+func TestPresetArgs(t *testing.T) {
+	def := scriptDefinition{script: SCRIPT}
+	parser, _, err := newScriptParser(SCRIPT, &PipelineLink{pipeline: newPipelineTest(false)})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	def.flags = parser.Commands[SCRIPT.Id].Flags()
+	p, err := newPreset(def, []string{"--source", "a.xml", "--source", "b.xml", "-o", "out", "--zip", "--another-opt", "foo"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	args := strings.Join(p.args(def, map[string]string{"another-opt": "bar"}), " ")
+	a, _ := filepath.Abs("a.xml")
+	b, _ := filepath.Abs("b.xml")
+	if args != "--output out --source "+a+","+b+" --zip" {
+		t.Errorf("Wrong args %v", args)
+	}
+	//the paths are kept as they are when the data is sent
+	data, _ := filepath.Abs("presets_test.go")
+	if p, _ = newPreset(def, []string{"--source", "a.xml", "--data", "presets_test.go"}); p.Inputs["source"] != "a.xml" || p.Flags["data"] != data {
+		t.Errorf("Wrong paths with data %v %v", p.Inputs["source"], p.Flags["data"])
+	}
+	if p, _ = newPreset(def, []string{"--source", "file:/tmp/a.xml"}); p.Inputs["source"] != "file:/tmp/a.xml" {
+		t.Errorf("URI changed %v", p.Inputs["source"])
+	}
+}
+
+func TestPresetRepeatedFlags(t *testing.T) {
+	def := scriptDefinition{script: SCRIPT}
+	parser, _, err := newScriptParser(SCRIPT, &PipelineLink{pipeline: newPipelineTest(false)})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	def.flags = parser.Commands[SCRIPT.Id].Flags()
+	for _, args := range [][]string{
+		{"--single", "a.xml", "--single", "b.xml"},
+		{"--another-opt", "foo", "--another-opt", "bar"},
+		{"-o", "out", "-o", "other"},
+	} {
+		if _, err := newPreset(def, args); err == nil {
+			t.Errorf("Repeated flag didn't error %v", args)
+		}
+	}
+	p, err := newPreset(def, []string{"--include", "*.epub", "--include", "*.pef"})
+	if err != nil || p.Flags["include"] != "*.epub,*.pef" {
+		t.Errorf("Repeated list flag not joined %v %+v", err, p)
+	}
+}
+
+//A preset is no longer valid when the script loses one of its options
+func TestPresetValidateScriptChanged(t *testing.T) {
+	def := scriptDefinition{script: SCRIPT}
+	p := preset{Name: "old", Script: "test", Options: map[string]string{"removed-opt": "value"}}
+	if err := p.validate(def); err == nil || !strings.Contains(err.Error(), "removed-opt") {
+		t.Errorf("Expected an error about the removed option got %v", err)
+	}
+}
+
+func TestPresetListShowDelete(t *testing.T) {
+	_, _, restore := presetsDir(t)
+	defer restore()
+	err := storePresets(map[string]preset{
+		"b": preset{Script: "test", Options: map[string]string{"another-opt": "foo"}},
+		"a": preset{Script: "test"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cli := makePresetCli(t)
+	out := overrideOutput(cli)
+	if err := cli.Run([]string{"preset", "list"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if lines := strings.Split(out.String(), "\n"); len(lines) < 3 || lines[1] != "a\ttest" || lines[2] != "b\ttest" {
+		t.Errorf("Wrong list %q", out.String())
+	}
+	out.Reset()
+	if err := cli.Run([]string{"preset", "show", "b"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if !strings.Contains(out.String(), "--another-opt foo") {
+		t.Errorf("Options not shown %q", out.String())
+	}
+	if err := cli.Run([]string{"preset", "delete", "b"}); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if err := cli.Run([]string{"preset", "show", "b"}); err == nil {
+		t.Errorf("Deleted preset still found")
+	}
+	if err := cli.Run([]string{"preset", "list", "extra"}); err == nil {
+		t.Errorf("Wrong arguments didn't error")
+	}
+}
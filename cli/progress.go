@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bertfrees/go-subcommand"
+)
+
+//Progress rendering modes
+const (
+	PROGRESS_BAR        = "bar"        //progress bar redrawn in place
+	PROGRESS_PLAIN      = "plain"      //one line per milestone, for logs
+	PROGRESS_ACCESSIBLE = "accessible" //coarse announcements without cursor movement, for screen readers
+	PROGRESS_NONE       = "none"       //only the job's messages
+)
+
+var progressModes = []string{PROGRESS_BAR, PROGRESS_PLAIN, PROGRESS_NONE, PROGRESS_ACCESSIBLE}
+
+//Minimum time between two updates of the download progress
+const DOWNLOAD_PROGRESS_WAIT = 200 * time.Millisecond
+
+//Renders the job's messages, its progress and the download of its results
+type progressRenderer struct {
+	mode        string
+	out         io.Writer
+	value       float64 //last progress rendered
+	milestone   int     //last milestone announced
+	downloading bool    //the download was announced
+}
+
+//Creates a renderer, if mode is empty it's chosen after where the output goes: the bar
+//is only drawn on terminals and never when the debug messages are mixed with it
+func newProgressRenderer(mode string, out io.Writer) *progressRenderer {
+	if mode == "" {
+		mode = PROGRESS_PLAIN
+		if isTerminal(out) && log.Writer() == ioutil.Discard {
+			mode = PROGRESS_BAR
+		}
+	}
+	return &progressRenderer{mode: mode, out: out}
+}
+
+//Checks if the writer is a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+//Adds the option to choose the progress mode
+func addProgressOption(cmd *subcommand.Command, mode *string) {
+	cmd.AddOption("progress", "", "How to show the progress: "+strings.Join(progressModes, ", ")+" (by default bar on terminals and plain otherwise)", "", "MODE", func(name, value string) error {
+		if !contains(progressModes, value) {
+			return ValidationError{fmt.Errorf("%s is not a valid value for --%s. Allowed values are %s", value, name, strings.Join(progressModes, ", "))}
+		}
+		*mode = value
+		return nil
+	})
+}
+
+//Size of the steps between announced milestones
+func (r *progressRenderer) step() float64 {
+	if r.mode == PROGRESS_ACCESSIBLE {
+		return 0.25
+	}
+	return 0.1
+}
+
+func (r *progressRenderer) start() {
+	if r.mode == PROGRESS_BAR {
+		printProgressBar(r.out, r.value)
+	}
+}
+
+//Renders a message (if not empty) and the progress
+func (r *progressRenderer) update(message string, value float64) {
+	if value < r.value {
+		value = r.value
+	}
+	switch r.mode {
+	case PROGRESS_BAR:
+		//erase the progress bar (last two lines)
+		fmt.Fprint(r.out, "\n\033[1A\033[K\033[1A\033[K")
+		if message != "" {
+			fmt.Fprintf(r.out, "%v\n", message)
+		}
+		printProgressBar(r.out, value)
+	case PROGRESS_PLAIN, PROGRESS_ACCESSIBLE:
+		if message != "" {
+			fmt.Fprintf(r.out, "%v\n", message)
+		}
+		if milestone := int(math.Floor(value / r.step())); milestone > r.milestone {
+			r.milestone = milestone
+			if r.mode == PROGRESS_PLAIN {
+				fmt.Fprintf(r.out, "Progress: %.0f%%\n", float64(milestone)*r.step()*100)
+			} else {
+				fmt.Fprintf(r.out, "Job progress %.0f percent\n", float64(milestone)*r.step()*100)
+			}
+		}
+	default:
+		if message != "" {
+			fmt.Fprintf(r.out, "%v\n", message)
+		}
+	}
+	r.value = value
+}
+
+//Leaves the output ready for the next lines
+func (r *progressRenderer) end() {
+	if r.mode == PROGRESS_BAR {
+		fmt.Fprintln(r.out)
+	}
+}
+
+//Renders the number of bytes of the results downloaded so far
+func (r *progressRenderer) downloaded(n int64, done bool) {
+	switch r.mode {
+	case PROGRESS_BAR:
+		fmt.Fprintf(r.out, "\rDownloading results: %v", formatBytes(n))
+		if done {
+			fmt.Fprintln(r.out)
+		}
+	case PROGRESS_PLAIN, PROGRESS_ACCESSIBLE:
+		if !r.downloading {
+			fmt.Fprintln(r.out, "Downloading results")
+			r.downloading = true
+		}
+		if done {
+			fmt.Fprintf(r.out, "Downloaded results: %v\n", formatBytes(n))
+		}
+	}
+}
+
+func printProgressBar(stdOut io.Writer, value float64) {
+	line := ""
+	for len(line) < 78 {
+		line += "_"
+	}
+	bar := ""
+	for i := 1; i <= int(value * 72); i++ {
+		bar += "█"
+	}
+	for len(bar) < 216 { // 72 * 3 because 3 bytes per character
+		bar += "░"
+	}
+	fmt.Fprintf(stdOut, "%v\n%v %.1f%% ", line, bar, value * 100)
+}
+
+//Counts the bytes written through it and reports them as the download progress
+type downloadProgress struct {
+	io.Writer
+	renderer *progressRenderer
+	written  int64
+	shown    time.Time
+}
+
+func (d *downloadProgress) Write(data []byte) (n int, err error) {
+	n, err = d.Writer.Write(data)
+	d.written += int64(n)
+	if time.Since(d.shown) >= DOWNLOAD_PROGRESS_WAIT {
+		d.renderer.downloaded(d.written, false)
+		d.shown = time.Now()
+	}
+	return
+}
+
+//Renders the final size
+func (d *downloadProgress) done() {
+	if d.written > 0 {
+		d.renderer.downloaded(d.written, true)
+	}
+}
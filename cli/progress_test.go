@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+//Tests that the plain and accessible modes announce the milestones without moving the cursor
+func TestProgressRendererMilestones(t *testing.T) {
+	tests := map[string]string{
+		PROGRESS_PLAIN:      "msg\nProgress: 20%\nProgress: 50%\n",
+		PROGRESS_ACCESSIBLE: "msg\nJob progress 50 percent\n",
+		PROGRESS_NONE:       "msg\n",
+	}
+	for mode, expected := range tests {
+		out := bytes.NewBuffer([]byte{})
+		r := newProgressRenderer(mode, out)
+		r.start()
+		r.update("msg", 0.05)
+		r.update("", 0.2)
+		r.update("", 0.22)
+		r.update("", 0.55)
+		r.end()
+		if out.String() != expected {
+			t.Errorf("Wrong %v output %q!=%q", mode, out.String(), expected)
+		}
+	}
+}
+
+//Tests that the bar is only drawn by default on terminals
+func TestProgressRendererDefault(t *testing.T) {
+	if r := newProgressRenderer("", bytes.NewBuffer([]byte{})); r.mode != PROGRESS_PLAIN {
+		t.Errorf("Expected plain mode when not writing to a terminal, got %v", r.mode)
+	}
+	if r := newProgressRenderer(PROGRESS_BAR, bytes.NewBuffer([]byte{})); r.mode != PROGRESS_BAR {
+		t.Errorf("The given mode wasn't kept, got %v", r.mode)
+	}
+}
+
+func TestProgressRendererBar(t *testing.T) {
+	out := bytes.NewBuffer([]byte{})
+	r := newProgressRenderer(PROGRESS_BAR, out)
+	r.start()
+	r.update("msg", 0.5)
+	r.end()
+	if !strings.Contains(out.String(), "\033[1A\033[K") || !strings.Contains(out.String(), "50.0%") {
+		t.Errorf("Wrong bar output %q", out.String())
+	}
+}
+
+//Tests that the downloaded bytes are passed through and reported
+func TestDownloadProgress(t *testing.T) {
+	dest := bytes.NewBuffer([]byte{})
+	out := bytes.NewBuffer([]byte{})
+	progress := &downloadProgress{Writer: dest, renderer: newProgressRenderer(PROGRESS_BAR, out)}
+	progress.Write([]byte("some "))
+	progress.Write([]byte("results"))
+	progress.done()
+	if dest.String() != "some results" {
+		t.Errorf("Wrong data written %q", dest.String())
+	}
+	if !strings.HasSuffix(out.String(), "\rDownloading results: 12 B\n") {
+		t.Errorf("Wrong progress %q", out.String())
+	}
+	out.Reset()
+	progress = &downloadProgress{Writer: dest, renderer: newProgressRenderer(PROGRESS_PLAIN, out)}
+	progress.Write([]byte("some results"))
+	progress.done()
+	if out.String() != "Downloading results\nDownloaded results: 12 B\n" {
+		t.Errorf("Wrong plain progress %q", out.String())
+	}
+}
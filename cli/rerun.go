@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Adds the command to run a job again as it was defined in the server. The script
+//flags given after the job id replace the values of the job
+func AddRerunCommand(cli *Cli, link *PipelineLink) {
+	lastId := new(bool)
+	cmd := cli.AddRawCommand("rerun", "Runs a job again with the same script, inputs, options and priority, the script's flags change them", 1, func(command string, args ...string) error {
+		id, err := checkId(*lastId, command, args...)
+		if err != nil {
+			return err
+		}
+		jExec, err := rerunExecution(link, id, cli.RawArgs())
+		if err != nil {
+			return err
+		}
+		return jExec.run(cli.Output)
+	})
+	cmd.SetArity(-1, "[JOB_ID] [SCRIPT_OPTIONS]")
+	addLastId(cmd, lastId)
+}
+
+//Rebuilds the request of the job out of its definition in the server, the values not
+//set by the script flags in overrides are taken from the job as they were sent
+func rerunExecution(link *PipelineLink, id string, overrides []string) (*jobExecution, error) {
+	job, err := link.Job(id)
+	if err != nil {
+		return nil, linkError(err)
+	}
+	scriptId := job.Script.Id
+	if scriptId == "" {
+		scriptId = path.Base(job.Script.Href)
+	}
+	script, err := link.Script(scriptId)
+	if err != nil {
+		return nil, linkError(err)
+	}
+	//the job already has the required values
+	optional := script
+	optional.Inputs = append([]pipeline.Input{}, script.Inputs...)
+	for idx := range optional.Inputs {
+		optional.Inputs[idx].Required = false
+	}
+	optional.Options = append([]pipeline.Option{}, script.Options...)
+	for idx := range optional.Options {
+		optional.Options[idx].Required = false
+	}
+	jExec, err := parseScriptArgs(optional, link, overrides)
+	if err != nil {
+		return nil, ValidationError{err}
+	}
+	req := jExec.req
+	for _, input := range job.Script.Inputs {
+		if _, ok := req.Inputs[input.Name]; ok {
+			continue
+		}
+		for _, item := range input.Items {
+			u, err := url.Parse(item.Value)
+			if err != nil {
+				return nil, fmt.Errorf("Job %v has an invalid value for input %v: %v", id, input.Name, err)
+			}
+			req.Inputs[input.Name] = append(req.Inputs[input.Name], jobInputValue(*u))
+		}
+	}
+	for _, option := range job.Script.Options {
+		if _, ok := req.Options[option.Name]; ok {
+			continue
+		}
+		if len(option.Items) == 0 && option.Value != "" {
+			req.Options[option.Name] = append(req.Options[option.Name], jobOptionValue(option.Value))
+		}
+		for _, item := range option.Items {
+			req.Options[option.Name] = append(req.Options[option.Name], jobOptionValue(item.Value))
+		}
+	}
+	if req.Priority == "" {
+		req.Priority = job.Priority
+	}
+	if req.Nicename == "" {
+		req.Nicename = job.Nicename
+	}
+	return jExec, nil
+}
+
+//The values taken from the job were already resolved when it was sent
+func jobInputValue(value url.URL) func(bool) (url.URL, error) {
+	return func(bool) (url.URL, error) {
+		return value, nil
+	}
+}
+
+func jobOptionValue(value string) func(bool) (string, error) {
+	return func(bool) (string, error) {
+		return value, nil
+	}
+}
@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+var RERUN_JOB = pipeline.Job{
+	Id:       "job1",
+	Status:   "FAIL",
+	Nicename: "first try",
+	Priority: "low",
+	Script: pipeline.Script{
+		Id: "test",
+		Inputs: []pipeline.Input{
+			pipeline.Input{Name: "source", Items: []pipeline.Item{
+				pipeline.Item{Value: "file:/tmp/a.xml"},
+				pipeline.Item{Value: "file:/tmp/b.xml"},
+			}},
+		},
+		Options: []pipeline.Option{
+			pipeline.Option{Name: "test-opt", Value: "file:/tmp/opt.xml"},
+			pipeline.Option{Name: "another-opt", Value: "foo"},
+		},
+	},
+}
+
+func makeRerunCli(t *testing.T) (*Cli, *PipelineTest) {
+	pipe := newPipelineTest(false)
+	pipe.job = func(string, int) (pipeline.Job, error) {
+		return RERUN_JOB, nil
+	}
+	link := &PipelineLink{FsAllow: true, pipeline: pipe}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	AddRerunCommand(cli, link)
+	return cli, pipe
+}
+
+func TestRerunCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { LastIdPath = path }(LastIdPath)
+	LastIdPath = filepath.Join(dir, "lastid")
+	cli, pipe := makeRerunCli(t)
+	if err := cli.Run([]string{"rerun", "job1", "--another-opt", "bar", "--background"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	sent := pipe.jobRequest
+	if sent.Priority != "low" || sent.Nicename != "first try" {
+		t.Errorf("Priority and nicename not kept %+v", sent)
+	}
+	if len(sent.Inputs) != 1 || len(sent.Inputs[0].Items) != 2 || sent.Inputs[0].Items[1].Value != "file:/tmp/b.xml" {
+		t.Errorf("Inputs not kept %+v", sent.Inputs)
+	}
+	options := map[string]string{}
+	for _, option := range sent.Options {
+		options[option.Name] = option.Value
+	}
+	if options["test-opt"] != "file:/tmp/opt.xml" || options["another-opt"] != "bar" {
+		t.Errorf("Wrong options %v", options)
+	}
+	//invalid override
+	cli, _ = makeRerunCli(t)
+	if err := cli.Run([]string{"rerun", "job1", "--another-opt", "baz", "--background"}); err == nil {
+		t.Errorf("Invalid override didn't error")
+	}
+}
+
+func TestRerunCommandLastId(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(path string) { LastIdPath = path }(LastIdPath)
+	LastIdPath = filepath.Join(dir, "lastid")
+	if err := storeLastId("job1"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	cli, pipe := makeRerunCli(t)
+	if err := cli.Run([]string{"rerun", "--lastid", "--background"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !pipe.requested {
+		t.Errorf("Job not sent")
+	}
+}
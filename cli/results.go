@@ -0,0 +1,197 @@
+package cli
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bertfrees/go-subcommand"
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+const (
+	ResultPortsTemplate = `{{range .}}{{.Name}}{{if .MimeType}} ({{.MimeType}}){{end}}
+{{range .Files}}	{{.}}
+{{end}}{{end}}`
+)
+
+//Implemented by the pipeline clients able to download the results of a single output port
+type portDownloader interface {
+	PortResults(jobId, port string, w io.Writer) (ok bool, err error)
+}
+
+//Part of the results to store: the files of the output ports matching the include patterns
+//and none of the exclude patterns. Files are identified by their slash separated path in the
+//results, which starts with the port name
+type resultSelection struct {
+	ports    []string
+	includes []string
+	excludes []string
+}
+
+//Output port of a job and the paths of its files
+type resultPort struct {
+	Name     string
+	MimeType string
+	Files    []string
+}
+
+//Adds the options to select the results to store
+func addResultSelectionOptions(cmd *subcommand.Command, selection *resultSelection) {
+	cmd.AddOption("port", "", "Only store the results of the output port, may be repeated", "", "NAME", func(name, value string) error {
+		selection.ports = append(selection.ports, splitPatterns(value)...)
+		return nil
+	})
+	cmd.AddOption("include", "", "Only store the result files matching the pattern, may be repeated. Patterns containing a slash are matched against the path starting with the port name, the rest against the file name", "", "GLOB", func(name, value string) error {
+		patterns, err := checkPatterns(name, value)
+		selection.includes = append(selection.includes, patterns...)
+		return err
+	})
+	cmd.AddOption("exclude", "", "Leave out the result files matching the pattern, may be repeated", "", "GLOB", func(name, value string) error {
+		patterns, err := checkPatterns(name, value)
+		selection.excludes = append(selection.excludes, patterns...)
+		return err
+	})
+}
+
+//Splits comma separated values leaving out the empty ones
+func splitPatterns(value string) (patterns []string) {
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return
+}
+
+func checkPatterns(name, value string) ([]string, error) {
+	patterns := splitPatterns(value)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, ValidationError{fmt.Errorf("%v is not a valid pattern for --%v: %v", pattern, name, err)}
+		}
+	}
+	return patterns, nil
+}
+
+//True if nothing was selected, so all the results are stored
+func (s resultSelection) all() bool {
+	return len(s.ports) == 0 && len(s.includes) == 0 && len(s.excludes) == 0
+}
+
+//Checks if the file is selected
+func (s resultSelection) matches(name string) bool {
+	name = strings.TrimPrefix(path.Clean(name), "/")
+	if len(s.ports) > 0 && !contains(s.ports, strings.SplitN(name, "/", 2)[0]) {
+		return false
+	}
+	if len(s.includes) > 0 && !isExcluded(name, false, s.includes) {
+		return false
+	}
+	return !isExcluded(name, false, s.excludes)
+}
+
+//Returns the selected ports with their selected files
+func (s resultSelection) filter(ports []resultPort) []resultPort {
+	selected := []resultPort{}
+	for _, port := range ports {
+		if len(s.ports) > 0 && !contains(s.ports, port.Name) {
+			continue
+		}
+		files := []string{}
+		for _, file := range port.Files {
+			if s.matches(file) {
+				files = append(files, file)
+			}
+		}
+		port.Files = files
+		selected = append(selected, port)
+	}
+	return selected
+}
+
+//Returns the output ports listed in the job's results. The webservice lists the ports
+//as .../result/port/NAME and their files as .../idx/PATH
+func resultPorts(job pipeline.Job) []resultPort {
+	ports := []resultPort{}
+	for _, result := range job.Results.Result {
+		idx := strings.LastIndex(result.Href, "/port/")
+		if idx < 0 {
+			continue
+		}
+		port := resultPort{Name: result.Href[idx+len("/port/"):], MimeType: result.MimeType}
+		for _, file := range result.Result {
+			name := strings.TrimPrefix(file.Href, result.Href+"/")
+			if idx := strings.Index(file.Href, "/idx/"); idx >= 0 {
+				name = file.Href[idx+len("/idx/"):]
+			}
+			port.Files = append(port.Files, name)
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+//Downloads the job's results into w. When a single port is selected, and both the webservice
+//and the client allow it, only the results of that port are downloaded
+func (p PipelineLink) SelectedResults(jobId string, selection resultSelection, w io.Writer) (ok bool, err error) {
+	downloader, canDownload := p.pipeline.(portDownloader)
+	if len(selection.ports) != 1 || !canDownload {
+		return p.Results(jobId, w)
+	}
+	job, err := p.Job(jobId)
+	if err != nil {
+		return
+	}
+	for _, port := range resultPorts(job) {
+		if port.Name == selection.ports[0] {
+			return downloader.PortResults(jobId, port.Name, w)
+		}
+	}
+	return p.Results(jobId, w)
+}
+
+//Writes the selected entries of the zip written to it into a zip file. The data is spooled
+//the same way ZipInflator does
+type ZipFilter struct {
+	ZipInflator
+	file string
+}
+
+func NewZipFilter(file string, selection resultSelection) *ZipFilter {
+	return &ZipFilter{ZipInflator: ZipInflator{selection: selection}, file: file}
+}
+
+//Copies the selected entries, without decompressing them, into the zip file
+func (z *ZipFilter) Close() error {
+	if z.spool == nil {
+		return nil
+	}
+	defer z.Abort()
+	info, err := z.spool.Stat()
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(z.spool, info.Size())
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(z.file)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	writer := zip.NewWriter(out)
+	for _, f := range z.selected(reader.File) {
+		if err := writer.Copy(f); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
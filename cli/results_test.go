@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+var RESULTS_JOB = pipeline.Job{
+	Id:     "job1",
+	Status: "SUCCESS",
+	Results: pipeline.Results{
+		Href: "http://localhost/ws/jobs/job1/result",
+		Result: []pipeline.Result{
+			pipeline.Result{
+				Href:     "http://localhost/ws/jobs/job1/result/port/result",
+				MimeType: "application/zip",
+				Result: []pipeline.Result{
+					pipeline.Result{Href: "http://localhost/ws/jobs/job1/result/port/result/idx/result/book.epub"},
+					pipeline.Result{Href: "http://localhost/ws/jobs/job1/result/port/result/idx/result/notes.txt"},
+				},
+			},
+			pipeline.Result{
+				Href:     "http://localhost/ws/jobs/job1/result/port/report",
+				MimeType: "application/zip",
+				Result: []pipeline.Result{
+					pipeline.Result{Href: "http://localhost/ws/jobs/job1/result/port/report/idx/report/report.html"},
+				},
+			},
+		},
+	},
+}
+
+//Creates the zip of the results of RESULTS_JOB
+func createResultsZip(t *testing.T) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for _, name := range []string{"result/", "result/book.epub", "result/notes.txt", "report/report.html"} {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if !strings.HasSuffix(name, "/") {
+			f.Write([]byte(name))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestResultSelectionMatches(t *testing.T) {
+	selection := resultSelection{ports: []string{"result"}, excludes: []string{"*.txt"}}
+	for name, expected := range map[string]bool{
+		"result/book.epub":   true,
+		"result/notes.txt":   false,
+		"report/report.html": false,
+	} {
+		if selection.matches(name) != expected {
+			t.Errorf("Wrong match for %v, expected %v", name, expected)
+		}
+	}
+	selection = resultSelection{includes: []string{"report/*.html"}}
+	if !selection.matches("report/report.html") || selection.matches("result/book.epub") {
+		t.Errorf("Includes not matched against the path")
+	}
+	if !(resultSelection{}).all() || selection.all() {
+		t.Errorf("Wrong empty selection")
+	}
+}
+
+func TestResultPorts(t *testing.T) {
+	ports := resultPorts(RESULTS_JOB)
+	if len(ports) != 2 || ports[0].Name != "result" || ports[1].Name != "report" {
+		t.Fatalf("Wrong ports %+v", ports)
+	}
+	if strings.Join(ports[0].Files, " ") != "result/book.epub result/notes.txt" {
+		t.Errorf("Wrong files %v", ports[0].Files)
+	}
+	ports = resultSelection{ports: []string{"result"}, includes: []string{"*.epub"}}.filter(ports)
+	if len(ports) != 1 || strings.Join(ports[0].Files, " ") != "result/book.epub" {
+		t.Errorf("Wrong selection %+v", ports)
+	}
+}
+
+func TestZipInflatorSelection(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(folder)
+	zi := NewZipInflator(folder)
+	zi.selection = resultSelection{ports: []string{"result"}, excludes: []string{"*.txt"}}
+	zi.Write(createResultsZip(t))
+	if err := zi.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	extracted := []string{}
+	filepath.Walk(folder, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(folder, path)
+			extracted = append(extracted, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if strings.Join(extracted, " ") != "result/book.epub" {
+		t.Errorf("Wrong files extracted %v", extracted)
+	}
+}
+
+func TestZipFilter(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(folder)
+	file := filepath.Join(folder, "results.zip")
+	zf := NewZipFilter(file, resultSelection{ports: []string{"report"}})
+	zf.Write(createResultsZip(t))
+	if err := zf.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	reader, err := zip.OpenReader(file)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer reader.Close()
+	if len(reader.File) != 1 || reader.File[0].Name != "report/report.html" {
+		t.Errorf("Wrong entries %v", reader.File)
+	}
+}
+
+func TestResultsCommandList(t *testing.T) {
+	cli, link, pipe := makeReturningCli(nil, t)
+	pipe.job = func(string, int) (pipeline.Job, error) {
+		return RESULTS_JOB, nil
+	}
+	AddResultsCommand(cli, link)
+	out := overrideOutput(cli)
+	if err := cli.Run([]string{"results", "--list", "--exclude", "*.txt", "job1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := "result (application/zip)\n\tresult/book.epub\nreport (application/zip)\n\treport/report.html\n"
+	if out.String() != expected {
+		t.Errorf("Wrong list %q", out.String())
+	}
+	if pipe.call == RESULTS_CALL {
+		t.Errorf("Results downloaded while listing them")
+	}
+}
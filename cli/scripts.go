@@ -1,6 +1,9 @@
 package cli
 
 import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
@@ -8,10 +11,13 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
 	"regexp"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/bertfrees/blackterm"
 	"github.com/capitancambio/chalk"
@@ -22,24 +28,61 @@ import (
 //set the last id path (in utils)
 var LastIdPath = getLastIdPath(runtime.GOOS)
 
+//What to do with a foreground job when dp2 is interrupted
+const (
+	INTERRUPT_KEEP   = "keep"
+	INTERRUPT_DELETE = "delete"
+)
+
+//Returned when following a job is interrupted by the user
+var errInterrupted = errors.New("interrupted")
+
+var errNoOutput = errors.New("--output option is mandatory if the job is not running in the background")
+
+//Returned by follow when the job doesn't finish within the job timeout, with how far it got
+type jobTimedOut struct {
+	status   string
+	progress float64
+}
+
+func (t jobTimedOut) Error() string {
+	return fmt.Sprintf("job timed out with status %v", t.status)
+}
+
+//Registers the channel to receive the interrupt signals (mockable for testing)
+var notifyInterrupts = func(c chan os.Signal) {
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+}
+
+//Where the answers to the questions asked to the user are read from
+var stdIn io.Reader = os.Stdin
+
+//Checks if questions can be asked to the user through the writer (mockable for testing)
+var interactive = isTerminal
+
 //Represents the job request
 type JobRequest struct {
 	Script               string                                     //Script id to call
 	Nicename             string                                     //Job's nicename
 	Priority             string                                     //Job's priority
-	Options              map[string][]func([]byte) (string, error)  //Options for the script
-	Inputs               map[string][]func([]byte) (url.URL, error) //Input documents for the script
-	Data                 []byte                                     //Data to send with the job request
+	Options              map[string][]func(bool) (string, error)  //Options for the script, validated knowing if the data is remote
+	Inputs               map[string][]func(bool) (url.URL, error) //Input documents for the script
+	RemoteData           bool                                     //The files are sent in a zip instead of being read from the local fs
+	DataPath             string                                   //Zip file or directory to send as data
+	DataExcludes         []string                                 //Patterns of the files left out when zipping a data directory
+	Data                 io.Reader                                //Data to send with the job request, streamed while sending it
+	dataEntries          []string                                 //Files contained in the data
 	Background           bool                                       //Send the request and return
-	StylesheetParameters map[string]func([]byte) (pipeline.StylesheetParameter, error)
+	SavePath             string                                     //File where the resolved request is saved before sending it
+	StylesheetParameters map[string]func(bool) (pipeline.StylesheetParameter, error)
 }
 
 //Creates a new JobRequest
 func newJobRequest() *JobRequest {
 	return &JobRequest{
-		Options:              make(map[string][]func([]byte) (string, error)),
-		Inputs:               make(map[string][]func([]byte) (url.URL, error)),
-		StylesheetParameters: make(map[string]func([]byte) (pipeline.StylesheetParameter, error)),
+		Options:              make(map[string][]func(bool) (string, error)),
+		Inputs:               make(map[string][]func(bool) (url.URL, error)),
+		StylesheetParameters: make(map[string]func(bool) (pipeline.StylesheetParameter, error)),
 	}
 }
 
@@ -62,109 +105,390 @@ func (c *Cli) AddScripts(scripts []pipeline.Script, link *PipelineLink) error {
 
 //Executes a job request
 type jobExecution struct {
-	link       *PipelineLink
-	req        *JobRequest
-	output     string
-	verbose    bool
-	persistent bool
-	zipped     bool
+	link        *PipelineLink
+	req         *JobRequest
+	output      string
+	verbose     bool
+	persistent  bool
+	zipped      bool
+	onInterrupt string //keep or delete the job when interrupted, ask if empty
+	progress    string //progress rendering mode, chosen after the output if empty
+	events      string          //format of the event stream written instead of the human readable output
+	jobTimeout  time.Duration   //time after which the job is no longer followed, taken from the configuration if zero
+	dryRun      bool            //print the job request instead of sending it
+	selection   resultSelection //results to store, all of them if empty
+	files       jobFiles        //log and metadata written along with the results
+	ifExists    string          //what to do when the output already exists, taken from the configuration if empty
+	hooks       jobHooks        //commands run once the job ends, taken from the configuration if empty
+	unattended  bool            //run by batch or watch: interrupts are not trapped and end dp2, leaving the job running
+	submitted   time.Time       //when the job was sent
 }
 
+//Prints the human readable output, unless events are written instead
+func (j jobExecution) say(stdOut io.Writer, format string, args ...interface{}) {
+	if j.events == "" {
+		fmt.Fprintf(stdOut, format, args...)
+	}
+}
+
+//Prints a warning, to stderr when events are written so the stream isn't broken
+func (j jobExecution) warn(stdOut io.Writer, format string, args ...interface{}) {
+	if j.events != "" {
+		stdOut = os.Stderr
+	}
+	fmt.Fprintf(stdOut, "Warning: "+format, args...)
+}
+
+//Returns the renderer of the job's progress, nothing is rendered when events are written
+func (j jobExecution) renderer(stdOut io.Writer) *progressRenderer {
+	if j.events != "" {
+		//nothing is rendered, the warnings about the results go to stderr
+		return newProgressRenderer(PROGRESS_NONE, os.Stderr)
+	}
+	return newProgressRenderer(j.progress, stdOut)
+}
+
+//Runs the job, a JobStatusError is returned if it didn't succeed
 func (j jobExecution) run(stdOut io.Writer) error {
-	log.Printf("run data len %v\n", len(j.req.Data))
+	if j.dryRun {
+		return j.printRequest(stdOut)
+	}
+	job, status, _, err := j.execute(stdOut)
+	if _, hookFailed := err.(HookError); (err != nil && !hookFailed) || j.req.Background {
+		return linkError(err)
+	}
+	//the job's status comes first when both the job and the hook failed
+	var errs errorList
+	errs.add(jobStatusError(job.Id, status))
+	errs.add(err)
+	return errs.err()
+}
+
+//Sends the job and, unless it runs in the background, follows it until it finishes and
+//stores its results. Returns the job as it was created, the status in which it finished
+//and where its results were stored
+func (j jobExecution) execute(stdOut io.Writer) (job pipeline.Job, status, output string, err error) {
+	log.Printf("run data %v\n", j.req.DataPath)
 	//manual check of output
 	if !j.req.Background && j.output == "" {
-		return errors.New("--output option is mandatory if the job is not running in the background")
+		return job, status, output, ValidationError{errNoOutput}
 	}
 	if j.req.Background && j.output != "" {
-		fmt.Printf("Warning: --output option ignored as the job will run in the background\n")
+		j.warn(stdOut, "--output option ignored as the job will run in the background\n")
 	}
 	storeId := j.req.Background || j.persistent
+	if j.jobTimeout, err = j.timeout(); err != nil {
+		return
+	}
+	//fail before sending the job rather than after it ran
+	if !j.req.Background {
+		if j.ifExists, err = ifExistsPolicy(j.ifExists, j.link.config); err != nil {
+			return
+		}
+		if err = checkOutput(j.output, j.ifExists); err != nil {
+			return
+		}
+	}
+	if err = j.req.loadData(); err != nil {
+		err = ValidationError{err}
+		return
+	}
 	//send the job
-	job, messages, err := j.link.Execute(*(j.req))
+	done := make(chan struct{})
+	job, messages, err := j.link.Execute(*(j.req), done)
 	if err != nil {
-		return err
+		return
+	}
+	j.submitted = time.Now()
+	j.say(stdOut, "Job %v sent to the server\n", job.Id)
+	if events := newEventWriter(j.events, stdOut, job.Id); events != nil {
+		events.emit(EVENT_SUBMITTED, jobEvent{"script": j.req.Script, "nicename": j.req.Nicename, "background": j.req.Background})
 	}
-	fmt.Fprintf(stdOut, "Job %v sent to the server\n", job.Id)
 	//store id if it suits
 	if storeId {
 		err = storeLastId(job.Id)
 		if err != nil {
+			return
+		}
+	}
+	status, err = j.follow(job, messages, done, stdOut)
+	if err == errInterrupted {
+		err = j.interrupted(job, stdOut)
+		return
+	}
+	if state, ok := err.(jobTimedOut); ok {
+		err = j.timedOut(job, state, stdOut)
+		return
+	}
+	if err != nil {
+		return
+	}
+	//get the data
+	if !j.req.Background {
+		if output, err = j.finish(job, status, stdOut); err != nil {
+			return
+		}
+		err = j.runHooks(job, status, output, stdOut)
+	}
+	return
+}
+
+//Job request as printed by --dry-run in JSON, options have a single value or a list of items
+type printableJobRequest struct {
+	Script   string                 `json:"script"`
+	Nicename string                 `json:"nicename,omitempty"`
+	Priority string                 `json:"priority,omitempty"`
+	Inputs   map[string][]string    `json:"inputs,omitempty"`
+	Options  map[string]interface{} `json:"options,omitempty"`
+}
+
+//Prints the job request as it would be sent, in XML and JSON, without sending it.
+//Every validation error is reported instead of just the first one
+func (j jobExecution) printRequest(stdOut io.Writer) error {
+	var errs errorList
+	if !j.req.Background && j.output == "" {
+		errs.add(errNoOutput)
+	}
+	if _, err := j.timeout(); err != nil {
+		errs.add(err)
+	}
+	//the data is needed to check that the files the request points to are in it
+	if err := j.req.loadData(); err != nil {
+		errs.add(err)
+	}
+	defer j.req.closeData()
+	req, err := jobRequestToPipeline(*j.req, *j.link)
+	errs.add(err)
+	if err := errs.err(); err != nil {
+		return ValidationError{err}
+	}
+	if j.req.SavePath != "" {
+		if err := saveJobRequest(req, j.req.SavePath); err != nil {
 			return err
 		}
 	}
+	xmlReq, err := xml.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return err
+	}
+	printable := printableJobRequest{
+		Script:   req.Script.Href,
+		Nicename: req.Nicename,
+		Priority: req.Priority,
+		Inputs:   map[string][]string{},
+		Options:  map[string]interface{}{},
+	}
+	for _, input := range req.Inputs {
+		for _, item := range input.Items {
+			printable.Inputs[input.Name] = append(printable.Inputs[input.Name], item.Value)
+		}
+	}
+	for _, option := range req.Options {
+		if len(option.Items) == 0 {
+			printable.Options[option.Name] = option.Value
+			continue
+		}
+		items := []string{}
+		for _, item := range option.Items {
+			items = append(items, item.Value)
+		}
+		printable.Options[option.Name] = items
+	}
+	jsonReq, err := json.MarshalIndent(printable, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdOut, "Job request (XML):\n%s\n\nJob request (JSON):\n%s\n\nDry run, the job was not sent\n", xmlReq, jsonReq)
+	return nil
+}
+
+//Prints the job's messages and progress as they are fed into the channel and returns
+//the status in which the job finished. If the user interrupts dp2 errInterrupted is returned,
+//if the job doesn't finish within the job timeout jobTimedOut is returned
+func (j jobExecution) follow(job pipeline.Job, messages chan Message, done chan struct{}, stdOut io.Writer) (status string, err error) {
+	defer stopFollowing(messages, done)
+	var interrupts chan os.Signal
+	if !j.unattended {
+		interrupts = make(chan os.Signal, 1)
+		notifyInterrupts(interrupts)
+		defer signal.Stop(interrupts)
+	}
+	var expired <-chan time.Time
+	if j.jobTimeout > 0 {
+		timer := time.NewTimer(j.jobTimeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
 	//get realtime messages, status and progress from the webservice
-	status := job.Status
-	progress := 0.0
-	printProgressBar(stdOut, progress)
-	for msg := range messages {
+	status = job.Status
+	progress := job.Messages.Progress
+	renderer := j.renderer(stdOut)
+	events := newEventWriter(j.events, stdOut, job.Id)
+	renderer.start()
+	for {
+		var msg Message
+		var ok bool
+		select {
+		case msg, ok = <-messages:
+		case <-interrupts:
+			//leave the half drawn progress bar behind
+			renderer.end()
+			err = errInterrupted
+			return
+		case <-expired:
+			renderer.end()
+			err = jobTimedOut{status: status, progress: progress}
+			return
+		}
+		if !ok {
+			renderer.end()
+			return
+		}
 		if msg.Error != nil {
+			renderer.end()
 			err = msg.Error
-			return err
+			return
 		}
-		if j.verbose && msg.Message != "" || msg.Progress > progress {
-			//erase the progress bar (last two lines)
-			//FIXME: don't do this when debug logging enabled
-			fmt.Fprint(stdOut, "\n\033[1A\033[K\033[1A\033[K")
-			if j.verbose && msg.Message != "" {
-				fmt.Fprintf(stdOut, "%v\n", msg.String())
-			}
-			if (msg.Progress > progress) {
-				progress = msg.Progress
+		if events != nil {
+			events.message(msg, j.verbose)
+		} else if j.verbose && msg.Message != "" || msg.Progress > renderer.value {
+			message := ""
+			if j.verbose {
+				message = msg.String()
 			}
-			printProgressBar(stdOut, progress)
+			renderer.update(message, msg.Progress)
+		}
+		if msg.Progress > progress {
+			progress = msg.Progress
 		}
 		status = msg.Status
 	}
+}
 
-	if status != "ERROR" {
-		//get the data
-		if !j.req.Background {
-			wc, err := zipProcessor(j.output, j.zipped)
-			if err != nil {
-				return err
-			}
-			ok, err := j.link.Results(job.Id, wc)
-			if err != nil {
-				return err
-			}
-			if err := wc.Close(); err != nil {
-				return err
-			}
-			fmt.Fprintln(stdOut)
-			if !j.persistent {
-				_, err = j.link.Delete(job.Id)
-				if err != nil {
-					return err
-				}
-				fmt.Fprintf(stdOut, "The job has been deleted from the server\n")
-			}
-			fmt.Fprintf(stdOut, "Job finished with status: %v\n", status)
-			if (!ok && (status == "SUCCESS" || status == "FAIL")) {
-				fmt.Fprintf(stdOut, "No results available\n")
-			}
+//Returns the job timeout given by --job-timeout or, if not given, by the configuration
+func (j jobExecution) timeout() (time.Duration, error) {
+	if j.jobTimeout > 0 {
+		return j.jobTimeout, nil
+	}
+	timeout, err := j.link.config.durationValue(JOBTIMEOUT)
+	if err != nil {
+		return 0, ValidationError{fmt.Errorf("%v is not a valid value for %v: %v", j.link.config[JOBTIMEOUT], JOBTIMEOUT, err)}
+	}
+	return timeout, nil
+}
+
+//Handles a job which didn't finish within the job timeout: how far it got is reported and
+//the job is either deleted or left running depending on the on-interrupt policy, it's kept when
+//not set as nobody may be there to answer
+func (j jobExecution) timedOut(job pipeline.Job, state jobTimedOut, stdOut io.Writer) error {
+	if err := storeLastId(job.Id); err != nil {
+		return err
+	}
+	j.say(stdOut, "The job didn't finish within %v, its status was %v and its progress %.0f%%\n", j.jobTimeout, state.status, state.progress*100)
+	if events := newEventWriter(j.events, stdOut, job.Id); events != nil {
+		events.emit(EVENT_TIMEOUT, jobEvent{"timeout": j.jobTimeout.String(), "status": state.status, "progress": state.progress})
+	}
+	policy := j.onInterrupt
+	if policy == "" {
+		policy = INTERRUPT_KEEP
+	}
+	if err := j.leave(job, policy, stdOut); err != nil {
+		return err
+	}
+	return JobTimeoutError{JobId: job.Id, Timeout: j.jobTimeout}
+}
+
+//Adds the option to choose what to do with the followed job when dp2 is interrupted or the
+//job times out
+func addOnInterruptOption(cmd *subcommand.Command, policy *string) {
+	cmd.AddOption("on-interrupt", "", "What to do with the job when dp2 is interrupted or the job times out. If not given the user is asked when dp2 runs in a terminal, otherwise the job is kept", "", "(keep|delete)", func(name, value string) error {
+		if value != INTERRUPT_KEEP && value != INTERRUPT_DELETE {
+			return ValidationError{fmt.Errorf("%s is not a valid value for --%s. Allowed values are keep and delete", value, name)}
 		}
+		*policy = value
+		return nil
+	})
+}
 
+//Handles an interrupted job: the id is stored and the job is either deleted or left running
+//depending on the on-interrupt policy, which is asked to the user when not set. The job is
+//kept if nobody can be asked
+func (j jobExecution) interrupted(job pipeline.Job, stdOut io.Writer) error {
+	if err := storeLastId(job.Id); err != nil {
+		return err
+	}
+	policy := j.onInterrupt
+	if policy == "" && (j.events != "" || !interactive(stdOut)) {
+		//don't break the event stream with questions nor wait for answers that won't come
+		policy = INTERRUPT_KEEP
+	}
+	if policy == "" {
+		fmt.Fprintf(stdOut, "Delete job %v from the server? [y/N] ", job.Id)
+		answer, _ := bufio.NewReader(stdIn).ReadString('\n')
+		policy = INTERRUPT_KEEP
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+			policy = INTERRUPT_DELETE
+		}
+	}
+	if err := j.leave(job, policy, stdOut); err != nil {
+		return err
+	}
+	return fmt.Errorf("Job %v interrupted", job.Id)
+}
+
+//Deletes the job or leaves it running depending on the policy
+func (j jobExecution) leave(job pipeline.Job, policy string, stdOut io.Writer) error {
+	if policy == INTERRUPT_DELETE {
+		if _, err := j.link.Delete(job.Id); err != nil {
+			return err
+		}
+		j.say(stdOut, "The job has been deleted from the server\n")
+	} else {
+		j.say(stdOut, "The job is still running on the server, use --lastid to refer to it\n")
 	}
 	return nil
 }
 
-func printProgressBar(stdOut io.Writer, value float64) {
-	line := ""
-	for len(line) < 78 {
-		line += "_"
+//Stores the results of the finished job and deletes it from the server unless
+//it is persistent. Returns where the results were stored
+func (j jobExecution) finish(job pipeline.Job, status string, stdOut io.Writer) (stored string, err error) {
+	if j.ifExists, err = ifExistsPolicy(j.ifExists, j.link.config); err != nil {
+		return
+	}
+	ok := false
+	stored = filesOutput(j.output, j.zipped, j.ifExists)
+	if status != "ERROR" {
+		if ok, stored, err = storeResults(*j.link, job.Id, j.output, j.zipped, j.selection, j.ifExists, j.renderer(stdOut)); err != nil {
+			return
+		}
+	}
+	//written before the job is deleted
+	if err = j.files.store(*j.link, job.Id, stored, j.zipped, j.submitted, time.Now()); err != nil {
+		return
 	}
-	bar := ""
-	for i := 1; i <= int(value * 72); i++ {
-		bar += "█"
+	if status == "ERROR" {
+		return
 	}
-	for len(bar) < 216 { // 72 * 3 because 3 bytes per character
-		bar += "░"
+	if events := newEventWriter(j.events, stdOut, job.Id); events != nil {
+		events.emit(EVENT_RESULTS, jobEvent{"output": stored, "zipped": j.zipped, "available": ok})
 	}
-	fmt.Fprintf(stdOut, "%v\n%v %.1f%% ", line, bar, value * 100)
+	if !j.persistent {
+		_, err = j.link.Delete(job.Id)
+		if err != nil {
+			return
+		}
+		j.say(stdOut, "The job has been deleted from the server\n")
+	}
+	j.say(stdOut, "Job finished with status: %v\n", status)
+	if (!ok && (status == "SUCCESS" || status == "FAIL")) {
+		j.say(stdOut, "No results available\n")
+	} else if stored != j.output {
+		j.say(stdOut, "Results stored into %v as %v already exists\n", stored, j.output)
+	}
+	return
 }
 
-var commonFlags = []string{"--output", "--zip", "--nicename", "--priority", "--quiet", "--persistent", "--background"}
+var commonFlags = []string{"--output", "--zip", "--port", "--include", "--exclude", "--with-log", "--with-metadata", "--if-exists", "--on-success", "--on-failure", "--nicename", "--priority", "--quiet", "--persistent", "--background", "--on-interrupt", "--job-timeout", "--save-request", "--dry-run", "--progress", "--events"}
 
 func getFlagName(name, prefix string, flags []subcommand.Flag) string {
 	flaggedName := "--" + name
@@ -211,18 +535,23 @@ var contentTypeForScript = map[string]string {
 	"zedai-to-epub3":   "application/z3998-auth+xml",
 }
 
-//Adds the command and flags to be able to call the script to the cli
-func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req *JobRequest, err error) {
+//Creates a new job execution for the given script
+func newJobExecution(link *PipelineLink, scriptId string) *jobExecution {
 	jobRequest := newJobRequest()
-	jobRequest.Script = script.Id
+	jobRequest.Script = scriptId
 	jobRequest.Background = false
-	jExec := jobExecution{
+	return &jobExecution{
 		link:    link,
 		req:     jobRequest,
 		output:  "",
 		verbose: true,
 		zipped:  false,
 	}
+}
+
+//Adds the command and flags to be able to call the script to the cli
+func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req *JobRequest, err error) {
+	jExec := newJobExecution(link, script.Id)
 	desc := blackterm.MarkdownString(script.Description)
 	command := cli.AddScriptCommand(
 		script.Id,
@@ -234,10 +563,44 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 			}
 			return nil
 		},
-		jobRequest,
+		jExec.req,
 	)
 	command.SetArity(0, "")
+	return jExec.req, addScriptFlags(command, script, link, jExec)
+}
+
+//Parses the script flags contained in args into a job execution without running it.
+//This allows other commands to build job requests the same way script commands do
+func parseScriptArgs(script pipeline.Script, link *PipelineLink, args []string) (*jobExecution, error) {
+	parser, jExec, err := newScriptParser(script, link)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parser.Parse(append([]string{script.Id}, args...)); err != nil {
+		return nil, err
+	}
+	return jExec, nil
+}
+
+//Creates a parser containing only the script command, whose flags fill the returned job execution
+func newScriptParser(script pipeline.Script, link *PipelineLink) (*subcommand.Parser, *jobExecution, error) {
+	jExec := newJobExecution(link, script.Id)
+	parser := subcommand.NewParser(script.Id)
+	command := parser.AddCommand(script.Id, "", "", func(string, ...string) error {
+		return nil
+	})
+	command.SetArity(0, "")
+	if err := addScriptFlags(command, script, link, jExec); err != nil {
+		return nil, nil, err
+	}
+	(&ScriptCommand{command, jExec.req}).addDataOption(!link.IsLocal())
+	return parser, jExec, nil
+}
 
+//Adds the flags for the script's inputs, options and the common flags to the command.
+//The flags fill the job execution
+func addScriptFlags(command *subcommand.Command, script pipeline.Script, link *PipelineLink, jExec *jobExecution) error {
+	jobRequest := jExec.req
 	for _, input := range script.Inputs {
 		name := getFlagName(input.Name, "i-", command.Flags())
 		shortDesc := input.ShortDesc
@@ -292,44 +655,36 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 	}
 
 	if hasStylesheetParametersOption {
-		medium := mediumForScript[script.Id]
-		contentType := contentTypeForScript[script.Id]
-		if medium != "" && contentType != "" {
-			params, err := link.StylesheetParameters(
-				StylesheetParametersRequest{
-					Medium:  medium,
-					ContentType: contentType,
-				})
-			if err != nil {
-				return jobRequest, err
+		params, err := scriptStylesheetParameters(script, link)
+		if err != nil {
+			return err
+		}
+		for _, param := range params {
+			name := getFlagName(param.Name, "x-", command.Flags())
+			shortDesc := param.ShortDesc
+			longDesc := param.LongDesc
+			possibleValues := optionTypeToDetailedHelp(param.Type)
+			if (possibleValues != "") {
+				longDesc += ("\n\nPossible values: " + possibleValues)
 			}
-			for _, param := range params.Parameters {
-				name := getFlagName(param.Name, "x-", command.Flags())
-				shortDesc := param.ShortDesc
-				longDesc := param.LongDesc
-				possibleValues := optionTypeToDetailedHelp(param.Type)
-				if (possibleValues != "") {
-					longDesc += ("\n\nPossible values: " + possibleValues)
-				}
-				longDesc += "\n\nDefault value: "
-				if param.Default == "" {
-					longDesc += "(empty)"
-				} else {
-					longDesc += "`" + param.Default + "`"
-				}
-				if (shortDesc != "" && strings.HasPrefix(longDesc, shortDesc + "\n\n")) {
-					// don't interpret first line as markdown
-					longDesc = shortDesc + "\n\n" + blackterm.MarkdownString(longDesc[len(shortDesc)+2:])
-				} else {
-					longDesc = blackterm.MarkdownString(longDesc)
-				}
-				if (shortDesc == "") {
-					shortDesc = param.NiceName
-				}
-				command.AddOption(
-					name, "", shortDesc, longDesc, optionTypeToString(param.Type, name, param.Default),
-					paramFunc(jobRequest, param)).Must(false)
+			longDesc += "\n\nDefault value: "
+			if param.Default == "" {
+				longDesc += "(empty)"
+			} else {
+				longDesc += "`" + param.Default + "`"
+			}
+			if (shortDesc != "" && strings.HasPrefix(longDesc, shortDesc + "\n\n")) {
+				// don't interpret first line as markdown
+				longDesc = shortDesc + "\n\n" + blackterm.MarkdownString(longDesc[len(shortDesc)+2:])
+			} else {
+				longDesc = blackterm.MarkdownString(longDesc)
 			}
+			if (shortDesc == "") {
+				shortDesc = param.NiceName
+			}
+			command.AddOption(
+				name, "", shortDesc, longDesc, optionTypeToString(param.Type, name, param.Default),
+				paramFunc(jobRequest, param)).Must(false)
 		}
 	}
 
@@ -341,6 +696,10 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 		jExec.zipped = true
 		return nil
 	})
+	addResultSelectionOptions(command, &jExec.selection)
+	addJobFilesOptions(command, &jExec.files)
+	addIfExistsOption(command, &jExec.ifExists)
+	addHooksOptions(command, &jExec.hooks)
 
 	command.AddOption("nicename", "n", "Set job's nice name", "", italic("NICENAME"), func(name, nice string) error {
 		jExec.req.Nicename = nice
@@ -352,8 +711,8 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 			jExec.req.Priority = priority
 			return nil
 		} else {
-			return fmt.Errorf("%s is not a valid priority. Allowed values are high, medium and low",
-				priority)
+			return ValidationError{fmt.Errorf("%s is not a valid priority. Allowed values are high, medium and low",
+				priority)}
 		}
 	})
 	command.AddSwitch("quiet", "q", "Do not print the job's messages", func(string, string) error {
@@ -369,8 +728,34 @@ func scriptToCommand(script pipeline.Script, cli *Cli, link *PipelineLink) (req
 		jExec.req.Background = true
 		return nil
 	})
+	addOnInterruptOption(command, &jExec.onInterrupt)
+	command.AddOption("save-request", "", "Save the job request, with its options resolved, to a file that can be sent later with the submit command", "", italic("FILE"), func(name, path string) error {
+		jExec.req.SavePath = path
+		return nil
+	})
+	command.AddSwitch("dry-run", "", "Print the job request and report all the invalid values without sending the job", func(string, string) error {
+		jExec.dryRun = true
+		return nil
+	})
+	addJobTimeoutOption(command, &jExec.jobTimeout)
+	addProgressOption(command, &jExec.progress)
+	addEventsOption(command, &jExec.events)
+	return nil
+}
 
-	return jobRequest, nil
+//Returns the stylesheet parameters accepted by the script through its stylesheet-parameters option
+func scriptStylesheetParameters(script pipeline.Script, link *PipelineLink) ([]pipeline.StylesheetParameter, error) {
+	medium := mediumForScript[script.Id]
+	contentType := contentTypeForScript[script.Id]
+	if medium == "" || contentType == "" {
+		return nil, nil
+	}
+	params, err := link.StylesheetParameters(
+		StylesheetParametersRequest{
+			Medium:  medium,
+			ContentType: contentType,
+		})
+	return params.Parameters, err
 }
 
 func optionTypeToString(optionType pipeline.DataType, optionName string, defaultValue string) string {
@@ -503,25 +888,23 @@ func optionTypeToDetailedHelp(optionType pipeline.DataType) string {
 }
 
 func (c *ScriptCommand) addDataOption(required bool) {
-	c.AddOption("data", "d", "Zip file containing the files to convert", "", "", func(name, path string) error {
-		file, err := os.Open(path)
-		defer func() {
-			err := file.Close()
-			if err != nil {
-				log.Printf("Error closing file %v :%v", path, err.Error())
-			}
-		}()
-		if err != nil {
+	c.AddOption("data", "d", "Zip file or directory containing the files to convert", "", "", func(name, path string) error {
+		//the data is opened when the request is sent so it's streamed instead of loaded into memory
+		if _, err := os.Stat(path); err != nil {
 			return err
 		}
-		c.req.Data, err = ioutil.ReadAll(file)
-		//FIXME: this breaks the tests, but focused in a different thing right now
-		//if err != nil {
-		//return err
-		//}
-		log.Printf("data len %v\n", len(c.req.Data))
+		c.req.DataPath = path
+		c.req.RemoteData = true
 		return nil
 	}).Must(required)
+	c.AddOption("data-exclude", "", "Comma separated patterns of the files to leave out when --data is a directory (see also "+DATA_IGNORE_FILE+")", "", "PATTERNS", func(name, value string) error {
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				c.req.DataExcludes = append(c.req.DataExcludes, pattern)
+			}
+		}
+		return nil
+	})
 }
 
 //Returns a function that fills the request info with the subcommand option name
@@ -534,13 +917,17 @@ func inputFunc(req *JobRequest) func(string, string) error {
 		}
 		// FIXME: check if input is a sequence
 		for _, path := range strings.Split(value, ",") {
-			req.Inputs[name] = append(req.Inputs[name], func(data []byte) (result url.URL, err error) {
-				basePath := getBasePath(data)
+			req.Inputs[name] = append(req.Inputs[name], func(remote bool) (result url.URL, err error) {
 				var u *url.URL
-				u, err = pathToUri(path, basePath)
+				u, err = pathToUri(path, getBasePath(remote))
 				if err != nil {
 					return
 				}
+				if remote {
+					if err = req.checkInData(path); err != nil {
+						return
+					}
+				}
 				return *u, nil
 			})
 		}
@@ -558,8 +945,8 @@ func optionFunc(req *JobRequest, optionType pipeline.DataType, sequence bool) fu
 		var err error
 		if sequence {
 			for _, v := range strings.Split(value, ",") {
-				req.Options[name] = append(req.Options[name], func(data []byte) (string, error) {
-					v, err = validateOption(v, optionType, data)
+				req.Options[name] = append(req.Options[name], func(remote bool) (string, error) {
+					v, err = validateDataOption(req, v, optionType, remote)
 					if err != nil {
 						return v, validationError(name, v, err)
 					}
@@ -567,8 +954,8 @@ func optionFunc(req *JobRequest, optionType pipeline.DataType, sequence bool) fu
 				})
 			}
 		} else {
-			req.Options[name] = append(req.Options[name], func(data []byte) (string, error) {
-				value, err = validateOption(value, optionType, data)
+			req.Options[name] = append(req.Options[name], func(remote bool) (string, error) {
+				value, err = validateDataOption(req, value, optionType, remote)
 				if err != nil {
 					return value, validationError(name, value, err)
 				}
@@ -586,8 +973,8 @@ func paramFunc(req *JobRequest, param pipeline.StylesheetParameter) func(string,
 		if strings.HasPrefix("x-", name) {
 			name = name[2:]
 		}
-		req.StylesheetParameters[name] = func(data []byte) (pipeline.StylesheetParameter, error) {
-			value, err := validateOption(value, param.Type, data)
+		req.StylesheetParameters[name] = func(remote bool) (pipeline.StylesheetParameter, error) {
+			value, err := validateOption(value, param.Type, remote)
 			if err != nil {
 				return param, validationError(name, value, err)
 			}
@@ -606,7 +993,23 @@ func validationError(optionName, value string, cause error) error {
 	return errors.New(msg)
 }
 
-func validateOption(value string, optionType pipeline.DataType, data []byte) (result string, err error) {
+//Validates the option value and, when the data is remote, checks that the files
+//it points to are present in the data
+func validateDataOption(req *JobRequest, value string, optionType pipeline.DataType, remote bool) (result string, err error) {
+	result, err = validateOption(value, optionType, remote)
+	if err != nil || !remote {
+		return
+	}
+	switch optionType.(type) {
+	case pipeline.AnyFileURI, pipeline.AnyDirURI:
+		if err = req.checkInData(value); err != nil {
+			err = errors.New("does not match " + uncolor(optionTypeToString(optionType, "", "")) + ": " + err.Error())
+		}
+	}
+	return
+}
+
+func validateOption(value string, optionType pipeline.DataType, remote bool) (result string, err error) {
 	result = value
 	switch t := optionType.(type) {
 	case pipeline.XsBoolean:
@@ -628,13 +1031,13 @@ func validateOption(value string, optionType pipeline.DataType, data []byte) (re
 		// _, err = url.Parse(value)
 	case pipeline.AnyFileURI:
 		var u *url.URL
-		u, err = pathToUri(value, getBasePath(data))
+		u, err = pathToUri(value, getBasePath(remote))
 		if err == nil {
 			result = u.String()
 		}
 	case pipeline.AnyDirURI:
 		var u *url.URL
-		u, err = pathToUri(value, getBasePath(data))
+		u, err = pathToUri(value, getBasePath(remote))
 		if err == nil {
 			result = u.String()
 		}
@@ -647,7 +1050,7 @@ func validateOption(value string, optionType pipeline.DataType, data []byte) (re
 		}
 	case pipeline.Choice:
 		for _, v := range t.Values {
-			result, err = validateOption(value, v, data)
+			result, err = validateOption(value, v, remote)
 			if err == nil {
 				break
 			}
@@ -669,10 +1072,10 @@ func validateOption(value string, optionType pipeline.DataType, data []byte) (re
 	return
 }
 
-//Gets the basepath. If the fwk accepts local uri's (file:///)
-//getBasePath os.Getwd() otherwise it returns an empty string
-func getBasePath(data []byte) string {
-	if data == nil {
+//Gets the basepath. If the files are read from the local fs (file:///)
+//getBasePath os.Getwd() otherwise, when they are sent in the data zip, it returns an empty string
+func getBasePath(remote bool) string {
+	if !remote {
 		base, err := os.Getwd()
 		if err != nil {
 			panic("Error while getting current directory:" + err.Error())
@@ -730,7 +1133,7 @@ func pathToUri(path string, basePath string) (u *url.URL, err error) {
 			err = errors.New("uri not absolute: " + u.String())
 		}
 	} else {
-		// FIXME: check if file present in zip
+		//the presence of the file in the zip is checked once the data is opened
 		//TODO is opaque really apropriate?
 		u = &url.URL{
 			Opaque: toSlash(path),
@@ -1,27 +1,33 @@
 package cli
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 
 	"github.com/bertfrees/go-subcommand"
 	//"github.com/bertfrees/go-subcommand"
 	//"github.com/daisy-consortium/pipeline-clientlib-go"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetBasePath(t *testing.T) {
 	//return os.Getwd()
-	basePath := getBasePath(nil)
+	basePath := getBasePath(false)
 	if len(basePath) == 0 {
 		t.Error("Base path is 0")
 	}
 	if basePath[len(basePath)-1] != "/"[0] {
 		t.Error("Last element of the basePath should be /")
 	}
-	basePath = getBasePath(make([]byte, 0))
+	basePath = getBasePath(true)
 	if len(basePath) != 0 {
 		t.Errorf("Base path len is !=0: %v", basePath)
 	}
@@ -93,7 +99,7 @@ func TestScriptPriority(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	//parser.Parse([]string{"test","--source","value"})
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "low"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", makeDataDir(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "low"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -118,7 +124,7 @@ func TestScriptNiceName(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	//parser.Parse([]string{"test","--source","value"})
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--nicename", "my_job"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", makeDataDir(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--nicename", "my_job"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -142,7 +148,7 @@ func TestScriptPriorityMedium(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	////medium
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "medium"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", makeDataDir(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "medium"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -163,7 +169,7 @@ func TestScriptPriorityHigh(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	////medium
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "high"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", makeDataDir(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "high"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -183,7 +189,7 @@ func TestScriptPriorityWrongValue(t *testing.T) {
 	if err != nil {
 		t.Error("Unexpected error")
 	}
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "not_so_low"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", makeDataDir(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar", "--priority", "not_so_low"})
 	if err == nil {
 		t.Errorf("Wrong priority value didn't error")
 	}
@@ -205,7 +211,7 @@ func TestScriptToCommand(t *testing.T) {
 		t.Error("Unexpected error")
 	}
 	//parser.Parse([]string{"test","--source","value"})
-	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar"})
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "-d", makeDataDir(t), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar"})
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -213,28 +219,28 @@ func TestScriptToCommand(t *testing.T) {
 		t.Error("script not set")
 	}
 	fmt.Printf("jobRequest.Inputs %+v\n", jobRequest.Inputs)
-	input, err := jobRequest.Inputs["source"][0](jobRequest.Data)
+	input, err := jobRequest.Inputs["source"][0](jobRequest.RemoteData)
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
 	if input.String() != "./tmp/file" {
 		t.Errorf("Input source not set %v", input.String())
 	}
-	input, err = jobRequest.Inputs["single"][0](jobRequest.Data)
+	input, err = jobRequest.Inputs["single"][0](jobRequest.RemoteData)
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
 	if input.String() != "./tmp/file2" {
 		t.Errorf("Input source not set %v", input.String())
 	}
-	option, err := jobRequest.Options["test-opt"][0](jobRequest.Data)
+	option, err := jobRequest.Options["test-opt"][0](jobRequest.RemoteData)
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
 	if option != "./myfile.xml" {
 		t.Errorf("Option test opt not set %v", option)
 	}
-	option, err = jobRequest.Options["another-opt"][0](jobRequest.Data)
+	option, err = jobRequest.Options["another-opt"][0](jobRequest.RemoteData)
 	if err != nil {
 		t.Errorf("Unexpected error %v", err)
 	}
@@ -350,7 +356,7 @@ func TestScriptDefault(t *testing.T) {
 	//parser.Parse([]string{"test","--source","value"})
 	err = cli.Run([]string{"test", "-o", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar"})
 	// FIXME: make this job pass
-	if !os.IsNotExist(err) {
+	if !errors.Is(err, os.ErrNotExist) {
 		t.Errorf("Unexpected pass %v", err)
 		if err != nil {
 			t.Errorf("Unexpected error %v", err)
@@ -378,7 +384,7 @@ func TestScriptBackground(t *testing.T) {
 	//parser.Parse([]string{"test","--source","value"})
 	err = cli.Run([]string{"test", "-b", "-o", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar"})
 	// FIXME: make this job pass
-	if !os.IsNotExist(err) {
+	if !errors.Is(err, os.ErrNotExist) {
 		t.Errorf("Unexpected pass %v", err)
 		if err != nil {
 			t.Errorf("Unexpected error %v", err)
@@ -412,7 +418,7 @@ func TestScriptPersistent(t *testing.T) {
 	//parser.Parse([]string{"test","--source","value"})
 	err = cli.Run([]string{"test", "-p", "-o", os.TempDir(), "--source", "./tmp/file", "--single", "./tmp/file2", "--test-opt", "./myfile.xml", "--another-opt", "bar"})
 	// FIXME: make this job pass
-	if !os.IsNotExist(err) {
+	if !errors.Is(err, os.ErrNotExist) {
 		t.Errorf("Unexpected pass %v", err)
 		if err != nil {
 			t.Errorf("Unexpected error %v", err)
@@ -450,3 +456,242 @@ func TestGetFlagCommonExists(t *testing.T) {
 	}
 
 }
+
+//Sends an interrupt as soon as the job is being followed
+func mockInterrupt() func() {
+	back := notifyInterrupts
+	notifyInterrupts = func(c chan os.Signal) {
+		c <- os.Interrupt
+	}
+	return func() {
+		notifyInterrupts = back
+	}
+}
+
+func TestScriptInterruptDelete(t *testing.T) {
+	defer mockInterrupt()()
+	LastIdPath = os.TempDir() + string(os.PathSeparator) + "testLastId"
+	defer os.Remove(LastIdPath)
+	pipeline := newPipelineTest(false)
+	deleted := false
+	pipeline.delete = func(id string) (bool, error) {
+		deleted = true
+		return true, nil
+	}
+	link := &PipelineLink{FsAllow: true, pipeline: pipeline}
+	jExec := newJobExecution(link, "test")
+	jExec.output = os.TempDir()
+	jExec.onInterrupt = INTERRUPT_DELETE
+	err := jExec.run(ioutil.Discard)
+	if err == nil {
+		t.Errorf("Interrupted job didn't error")
+	}
+	if !deleted {
+		t.Errorf("Interrupted job wasn't deleted")
+	}
+	if _, err := getLastId(); err != nil {
+		t.Errorf("The id of the interrupted job wasn't stored")
+	}
+}
+
+func TestScriptInterruptAsk(t *testing.T) {
+	defer mockInterrupt()()
+	backIn := stdIn
+	backInteractive := interactive
+	defer func() {
+		stdIn = backIn
+		interactive = backInteractive
+	}()
+	interactive = func(io.Writer) bool { return true }
+	LastIdPath = os.TempDir() + string(os.PathSeparator) + "testLastId"
+	defer os.Remove(LastIdPath)
+	for answer, expected := range map[string]bool{"y\n": true, "\n": false} {
+		stdIn = strings.NewReader(answer)
+		pipeline := newPipelineTest(false)
+		deleted := false
+		pipeline.delete = func(id string) (bool, error) {
+			deleted = true
+			return true, nil
+		}
+		link := &PipelineLink{FsAllow: true, pipeline: pipeline}
+		jExec := newJobExecution(link, "test")
+		jExec.output = os.TempDir()
+		if err := jExec.run(ioutil.Discard); err == nil {
+			t.Errorf("Interrupted job didn't error")
+		}
+		if deleted != expected {
+			t.Errorf("Answering %q deleted the job: %v", answer, deleted)
+		}
+	}
+}
+
+func TestScriptInterruptNotInteractive(t *testing.T) {
+	defer mockInterrupt()()
+	backIn := stdIn
+	defer func() {
+		stdIn = backIn
+	}()
+	LastIdPath = os.TempDir() + string(os.PathSeparator) + "testLastId"
+	defer os.Remove(LastIdPath)
+	stdIn = strings.NewReader("y\n")
+	pipeline := newPipelineTest(false)
+	deleted := false
+	pipeline.delete = func(id string) (bool, error) {
+		deleted = true
+		return true, nil
+	}
+	link := &PipelineLink{FsAllow: true, pipeline: pipeline}
+	jExec := newJobExecution(link, "test")
+	jExec.output = os.TempDir()
+	out := new(bytes.Buffer)
+	if err := jExec.run(out); err == nil {
+		t.Errorf("Interrupted job didn't error")
+	}
+	if deleted || strings.Contains(out.String(), "[y/N]") {
+		t.Errorf("The user was asked without a terminal: %q", out.String())
+	}
+}
+
+func TestScriptUnattendedNotInterrupted(t *testing.T) {
+	defer mockInterrupt()()
+	defer mockSleep()()
+	link := &PipelineLink{FsAllow: true, pipeline: newPipelineTest(false)}
+	jExec := newJobExecution(link, "test")
+	jExec.output = os.TempDir()
+	jExec.unattended = true
+	_, status, _, err := jExec.execute(ioutil.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if status != "SUCCESS" {
+		t.Errorf("The job was interrupted, status %v", status)
+	}
+}
+
+//Creates a data directory with the files used by the script tests
+func makeDataDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "dp2_data_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	for _, name := range []string{"tmp/file", "tmp/file2", "myfile.xml"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("<doc/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestScriptJobTimeout(t *testing.T) {
+	LastIdPath = os.TempDir() + string(os.PathSeparator) + "testLastId"
+	defer os.Remove(LastIdPath)
+	pipeline := newPipelineTest(false)
+	deleted := false
+	pipeline.delete = func(id string) (bool, error) {
+		deleted = true
+		return true, nil
+	}
+	link := &PipelineLink{FsAllow: true, pipeline: pipeline}
+	jExec := newJobExecution(link, "test")
+	jExec.output = os.TempDir()
+	jExec.onInterrupt = INTERRUPT_DELETE
+	jExec.jobTimeout = 10 * time.Millisecond
+	out := new(bytes.Buffer)
+	err := jExec.run(out)
+	if _, ok := err.(JobTimeoutError); !ok {
+		t.Errorf("Expected a job timeout error got %#v", err)
+	}
+	if !deleted {
+		t.Errorf("Timed out job wasn't deleted")
+	}
+	if !strings.Contains(out.String(), "its status was RUNNING and its progress 75%") {
+		t.Errorf("How far the job got wasn't reported:\n%v", out.String())
+	}
+}
+
+func TestScriptJobTimeoutConfig(t *testing.T) {
+	LastIdPath = os.TempDir() + string(os.PathSeparator) + "testLastId"
+	defer os.Remove(LastIdPath)
+	pipeline := newPipelineTest(false)
+	deleted := false
+	pipeline.delete = func(id string) (bool, error) {
+		deleted = true
+		return true, nil
+	}
+	config := copyConf()
+	config[JOBTIMEOUT] = "10ms"
+	link := &PipelineLink{FsAllow: true, pipeline: pipeline, config: config}
+	jExec := newJobExecution(link, "test")
+	jExec.output = os.TempDir()
+	err := jExec.run(ioutil.Discard)
+	if _, ok := err.(JobTimeoutError); !ok {
+		t.Errorf("Expected a job timeout error got %#v", err)
+	}
+	if deleted {
+		t.Errorf("Timed out job was deleted without policy")
+	}
+	config[JOBTIMEOUT] = "soon"
+	jExec = newJobExecution(link, "test")
+	jExec.output = os.TempDir()
+	if err := jExec.run(ioutil.Discard); err == nil {
+		t.Errorf("Invalid job timeout didn't error")
+	}
+}
+
+func TestScriptDryRun(t *testing.T) {
+	source := filepath.Join(os.TempDir(), "dry_run_source.xml")
+	if err := ioutil.WriteFile(source, []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.Remove(source)
+	pipeline := newPipelineTest(false)
+	link := &PipelineLink{FsAllow: true, pipeline: pipeline}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	out := overrideOutput(cli)
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err = cli.Run([]string{"test", "-o", os.TempDir(), "--source", source, "--single", source, "--test-opt", source, "--another-opt", "bar", "--dry-run"})
+	if err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if pipeline.requested {
+		t.Errorf("The job was sent")
+	}
+	for _, expected := range []string{"<jobRequest", `name="another-opt">bar</option>`, `"another-opt": "bar"`} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("%v not found in the output:\n%v", expected, out.String())
+		}
+	}
+}
+
+//All the invalid values are reported at once
+func TestScriptDryRunErrors(t *testing.T) {
+	link := &PipelineLink{FsAllow: true, pipeline: newPipelineTest(false)}
+	cli, err := makeCli("test", link)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if _, err := scriptToCommand(SCRIPT, cli, link); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	err = cli.Run([]string{"test", "--source", "./tmp/file", "--test-opt", "./tmp/file.xml", "--another-opt", "baz", "--dry-run"})
+	if _, ok := err.(ValidationError); !ok {
+		t.Fatalf("Expected a validation error got %#v", err)
+	}
+	for _, expected := range []string{"--output", "./tmp/file", "--another-opt"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("%v not reported in:\n%v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+//Implemented by the pipeline clients able to send the job data without loading it into memory
+type dataStreamer interface {
+	JobRequestStream(newJob pipeline.JobRequest, data io.Reader) (job pipeline.Job, err error)
+}
+
+//Pipeline client that streams the job data in the multipart request, the clientlib
+//only accepts the data as a byte slice. The rest of calls are delegated to the clientlib
+type streamingPipeline struct {
+	*pipeline.Pipeline
+	clientKey    string
+	clientSecret string
+	client       *http.Client
+}
+
+func newStreamingPipeline(baseUrl string) *streamingPipeline {
+	return &streamingPipeline{
+		Pipeline: pipeline.NewPipeline(baseUrl),
+		client:   http.DefaultClient,
+	}
+}
+
+func (p *streamingPipeline) SetCredentials(clientKey, clientSecret string) {
+	p.Pipeline.SetCredentials(clientKey, clientSecret)
+	p.clientKey = clientKey
+	p.clientSecret = clientSecret
+}
+
+//Sends the job request along with the data, which is copied into the request body as it's read
+func (p *streamingPipeline) JobRequestStream(newJob pipeline.JobRequest, data io.Reader) (job pipeline.Job, err error) {
+	body, writer := io.Pipe()
+	mw := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeMultipartJob(mw, newJob, data))
+	}()
+	defer body.Close()
+	uri, err := p.sign(p.BaseUrl + "jobs")
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest("POST", uri, body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Accept", "application/xml")
+	log.Println("Sending streamed multipart job request")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return job, jobRequestError(resp)
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&job)
+	return
+}
+
+//Downloads the results of a single output port of the job, false is returned if the
+//webservice has no results for it
+func (p *streamingPipeline) PortResults(jobId, port string, w io.Writer) (ok bool, err error) {
+	uri, err := p.sign(p.BaseUrl + "jobs/" + jobId + "/result/port/" + url.PathEscape(port))
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Accept", "application/zip")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		_, err = io.Copy(w, resp.Body)
+		return err == nil, err
+	case http.StatusNotFound:
+		return false, nil
+	case http.StatusUnauthorized:
+		return false, AuthError{errors.New(pipeline.ERR_401)}
+	}
+	return false, fmt.Errorf("Unexpected status %v downloading the results of port %v", resp.StatusCode, port)
+}
+
+//Writes the data and the job request parts the same way the clientlib's MultipartEncoder
+//does, which only takes the data as a byte slice: TestMultipartJobLikeClientlib checks both
+//still write the same parts
+func writeMultipartJob(mw *multipart.Writer, newJob pipeline.JobRequest, data io.Reader) error {
+	header := make(textproto.MIMEHeader)
+	header.Add("Content-Disposition", `form-data; name="job-data"; filename="pipeline-client-go-data.zip"`)
+	header.Add("Content-Transfer-Encoding", "binary")
+	header.Add("Content-Type", "application/zip")
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, data); err != nil {
+		return err
+	}
+	header = make(textproto.MIMEHeader)
+	header.Add("Content-Disposition", `form-data; name="job-request"`)
+	header.Add("Content-Type", "application/xml; charset=utf-8")
+	if part, err = mw.CreatePart(header); err != nil {
+		return err
+	}
+	if err := xml.NewEncoder(part).Encode(&newJob); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+//Builds the error out of the response of a failed job request
+func jobRequestError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return AuthError{errors.New(pipeline.ERR_401)}
+	}
+	msg := fmt.Sprintf("Unexpected status %v sending the job request", resp.StatusCode)
+	if resp.StatusCode == http.StatusBadRequest {
+		msg = "Job request is not valid"
+	}
+	pErr := pipeline.Error{}
+	if err := xml.NewDecoder(resp.Body).Decode(&pErr); err == nil && pErr.Description != "" {
+		msg += ": " + pErr.Description
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		return ValidationError{errors.New(msg)}
+	}
+	return errors.New(msg)
+}
+
+//Signs the url with the client credentials following the webservice authentication scheme
+func (p *streamingPipeline) sign(uri string) (string, error) {
+	if p.clientKey == "" {
+		return uri, nil
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return "", err
+	}
+	return signUrl(uri, p.clientKey, p.clientSecret, time.Now().Format(AUTH_TIME_FORMAT), nonce), nil
+}
+
+//Format of the time in the signed urls
+const AUTH_TIME_FORMAT = "2006-01-02T15:04:05Z"
+
+//Returns a random nonce padded to 30 digits, unlike math/rand it doesn't repeat across runs
+func newNonce() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt64))
+	if err != nil {
+		return "", err
+	}
+	nonce := n.String()
+	return strings.Repeat("0", 30-len(nonce)) + nonce, nil
+}
+
+//Adds the authentication parameters and their signature to the url. This is the scheme of
+//the clientlib's authenticator, which isn't exported: TestSignUrlLikeClientlib checks both
+//still sign the same way
+func signUrl(uri, clientKey, clientSecret, timestamp, nonce string) string {
+	separator := "?"
+	if strings.Contains(uri, "?") {
+		separator = "&"
+	}
+	uri += fmt.Sprintf("%vauthid=%v&time=%v&nonce=%v", separator, clientKey, timestamp, nonce)
+	hasher := hmac.New(sha1.New, []byte(clientSecret))
+	hasher.Write([]byte(uri))
+	return uri + "&sign=" + url.QueryEscape(base64.StdEncoding.EncodeToString(hasher.Sum(nil)))
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func TestJobRequestStream(t *testing.T) {
+	var parts = map[string]string{}
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+			return
+		}
+		for part, err := reader.NextPart(); err == nil; part, err = reader.NextPart() {
+			contents, _ := ioutil.ReadAll(part)
+			parts[part.FormName()] = string(contents)
+		}
+		w.WriteHeader(http.StatusCreated)
+		xml.NewEncoder(w).Encode(pipeline.Job{Id: "job-id"})
+	}))
+	defer server.Close()
+	p := newStreamingPipeline(server.URL + "/")
+	p.SetCredentials("key", "secret")
+	job, err := p.JobRequestStream(pipeline.JobRequest{Nicename: "streamed"}, strings.NewReader("zip contents"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if job.Id != "job-id" {
+		t.Errorf("Expected job id job-id got %v", job.Id)
+	}
+	if parts["job-data"] != "zip contents" {
+		t.Errorf("Unexpected data part %q", parts["job-data"])
+	}
+	if !strings.Contains(parts["job-request"], "streamed") {
+		t.Errorf("Unexpected request part %q", parts["job-request"])
+	}
+	if !strings.Contains(query, "authid=key") || !strings.Contains(query, "sign=") {
+		t.Errorf("Request not signed %v", query)
+	}
+}
+
+func TestJobRequestStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+	p := newStreamingPipeline(server.URL + "/")
+	_, err := p.JobRequestStream(pipeline.JobRequest{}, strings.NewReader("zip contents"))
+	if err == nil {
+		t.Errorf("Invalid job request didn't error")
+	}
+	if _, ok := err.(ValidationError); !ok {
+		t.Errorf("Expected a validation error got %#v", err)
+	}
+}
+
+func TestPortResults(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		if strings.HasSuffix(r.URL.Path, "/port/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("zip contents"))
+	}))
+	defer server.Close()
+	p := newStreamingPipeline(server.URL + "/")
+	buf := new(strings.Builder)
+	ok, err := p.PortResults("job-id", "result", buf)
+	if err != nil || !ok {
+		t.Fatalf("Unexpected result %v %v", ok, err)
+	}
+	if requested != "/jobs/job-id/result/port/result" || buf.String() != "zip contents" {
+		t.Errorf("Wrong download %v %q", requested, buf.String())
+	}
+	if ok, err := p.PortResults("job-id", "missing", buf); ok || err != nil {
+		t.Errorf("Missing port not reported %v %v", ok, err)
+	}
+}
+
+//Records the query and body of the job request sent by the clientlib
+func clientlibJobRequest(t *testing.T, req pipeline.JobRequest, data []byte) (server *httptest.Server, query url.Values, body []byte) {
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		body, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		xml.NewEncoder(w).Encode(pipeline.Job{Id: "job-id"})
+	}))
+	p := pipeline.NewPipeline(server.URL + "/")
+	p.SetCredentials("key", "secret")
+	if _, err := p.JobRequest(req, data); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return
+}
+
+//The copy of the clientlib's signing scheme must not drift from it
+func TestSignUrlLikeClientlib(t *testing.T) {
+	server, query, _ := clientlibJobRequest(t, pipeline.JobRequest{Nicename: "signed"}, nil)
+	defer server.Close()
+	signed, err := url.Parse(signUrl(server.URL+"/jobs", "key", "secret", query.Get("time"), query.Get("nonce")))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if signed.Query().Get("sign") == "" || signed.Query().Get("sign") != query.Get("sign") {
+		t.Errorf("Signed differently than the clientlib: %v instead of %v", signed.Query(), query)
+	}
+}
+
+//The copy of the clientlib's multipart encoding must not drift from it
+func TestMultipartJobLikeClientlib(t *testing.T) {
+	req := pipeline.JobRequest{Nicename: "streamed"}
+	server, _, expected := clientlibJobRequest(t, req, []byte("zip contents"))
+	defer server.Close()
+	body := new(bytes.Buffer)
+	mw := multipart.NewWriter(body)
+	//the clientlib's boundary
+	boundary := strings.TrimPrefix(strings.SplitN(string(expected), "\r\n", 2)[0], "--")
+	if err := mw.SetBoundary(boundary); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := writeMultipartJob(mw, req, strings.NewReader("zip contents")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if body.String() != string(expected) {
+		t.Errorf("Encoded differently than the clientlib:\n%q\ninstead of\n%q", body.String(), expected)
+	}
+}
+
+func TestNewNonce(t *testing.T) {
+	first, err := newNonce()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	second, _ := newNonce()
+	if len(first) != 30 || first == second {
+		t.Errorf("Wrong nonces %v %v", first, second)
+	}
+}
@@ -2,7 +2,6 @@ package cli
 
 import (
 	"archive/zip"
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +12,8 @@ import (
 	re "regexp"
 	"runtime"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bertfrees/go-subcommand"
 )
@@ -41,7 +42,7 @@ func loadKey() (key string, err error) {
 	path := filepath.Join(os.TempDir(), keyFile)
 	file, err := os.Open(path)
 	if err != nil {
-		errors.New("Could not find the key file, is the webservice running in this machine?")
+		return "", errors.New("Could not find the key file, is the webservice running in this machine?")
 	}
 	bytes, err := ioutil.ReadAll(file)
 	if err != nil {
@@ -76,6 +77,33 @@ func addLastId(cmd *subcommand.Command, lastId *bool) {
 	cmd.SetArity(-1, "[JOB_ID]")
 }
 
+//Adds the option to stop following the job after some time
+func addJobTimeoutOption(cmd *subcommand.Command, timeout *time.Duration) {
+	cmd.AddOption("job-timeout", "", "Stop following the job if it hasn't finished after the given time, e.g. 90s, 30m or 2h (default job_timeout in the configuration)", "", "DURATION", func(name, value string) error {
+		d, err := parseDuration(value)
+		if err != nil {
+			return ValidationError{fmt.Errorf("%s is not a valid value for --%s: %v", value, name, err)}
+		}
+		*timeout = d
+		return nil
+	})
+}
+
+//Parses a duration such as 90s, 30m or 2h, a plain number is taken as seconds
+func parseDuration(value string) (time.Duration, error) {
+	if secs, err := strconv.Atoi(value); err == nil {
+		value = fmt.Sprintf("%ds", secs)
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, errors.New("the duration can't be negative")
+	}
+	return d, nil
+}
+
 //Calculates the absolute path in base of cwd and creates the directory
 func createAbsoluteFolder(folder string) (absPath string, err error) {
 	absPath, err = filepath.Abs(folder)
@@ -93,78 +121,254 @@ func mkdir(path string) error {
 	return nil
 }
 
+//Unzips the data written to it into a folder. The data is spooled to a temporary
+//file so the memory used doesn't depend on the size of the zip. Entries that would
+//end up outside the folder and symbolic links are not extracted but kept in Rejected
 type ZipInflator struct {
-	folder string
-	buff   *bytes.Buffer
+	folder    string
+	spool     *os.File
+	maxSize   int64           //Maximum number of bytes to extract, 0 means no limit
+	maxFiles  int             //Maximum number of files to extract, 0 means no limit
+	Rejected  []string        //Entries that were not extracted and why
+	selection resultSelection //Entries to extract, all of them if empty
 }
 
 func NewZipInflator(folder string) *ZipInflator {
 	return &ZipInflator{
 		folder: folder,
-		buff:   bytes.NewBuffer([]byte{}),
 	}
 
 }
 
-//Writes the  data to a intermediate buffer
+//Writes the data to the spool file, which is created on the first write
 func (z *ZipInflator) Write(data []byte) (int, error) {
-	return z.buff.Write(data)
+	if z.spool == nil && len(data) > 0 {
+		spool, err := ioutil.TempFile("", "dp2_results_")
+		if err != nil {
+			return 0, err
+		}
+		z.spool = spool
+	}
+	if z.spool == nil {
+		return 0, nil
+	}
+	return z.spool.Write(data)
 }
 
-//
+//Discards the data written so far
+func (z *ZipInflator) Abort() error {
+	if z.spool == nil {
+		return nil
+	}
+	z.spool.Close()
+	err := os.Remove(z.spool.Name())
+	z.spool = nil
+	return err
+}
+
+//Unzips the spooled data into the folder
 func (z *ZipInflator) Close() error {
-	l := int64(z.buff.Len())
-	//if  no data do not try to compress it
-	if l == 0 {
+	//if  no data do not try to uncompress it
+	if z.spool == nil {
 		return nil
 	}
-	reader, err := zip.NewReader(bytes.NewReader(z.buff.Bytes()), l)
+	defer z.Abort()
+	info, err := z.spool.Stat()
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(z.spool, info.Size())
 	if err != nil {
 		return err
 	}
+	files := z.selected(reader.File)
+	if err := z.checkLimits(files); err != nil {
+		return err
+	}
 	// Iterate through the files in the archive,
 	//and store the results
-	for _, f := range reader.File {
-		//Get the path of the new file
-		path := filepath.Join(z.folder, filepath.Clean(f.Name))
-		if err := mkdir(filepath.Dir(path)); err != nil {
-			return err
-		}
-
-		rc, err := f.Open()
+	remaining := z.maxSize
+	for _, f := range files {
+		path, err := z.entryPath(f)
 		if err != nil {
-			return err
+			z.Rejected = append(z.Rejected, fmt.Sprintf("%v: %v", f.Name, err))
+			continue
 		}
-
-		dest, err := os.Create(path)
-		if err != nil {
-			return err
+		if f.FileInfo().IsDir() {
+			if err := mkdir(path); err != nil {
+				return err
+			}
+			continue
 		}
-
-		if _, err = io.Copy(dest, rc); err != nil {
+		if err := mkdir(filepath.Dir(path)); err != nil {
 			return err
 		}
-
-		if err := dest.Close(); err != nil {
+		written, err := extractFile(f, path, remaining, z.maxSize > 0)
+		if err != nil {
 			return err
 		}
+		remaining -= written
+	}
+	return nil
+}
 
-		if err := rc.Close(); err != nil {
-			return err
+//Returns the selected entries, the directories are left out unless all the entries are
+//selected as they are created for the files anyway
+func (z *ZipInflator) selected(files []*zip.File) []*zip.File {
+	if z.selection.all() {
+		return files
+	}
+	selected := []*zip.File{}
+	for _, f := range files {
+		if !f.FileInfo().IsDir() && z.selection.matches(f.Name) {
+			selected = append(selected, f)
 		}
+	}
+	return selected
+}
 
+//Checks the number of files and the size the zip claims to have, the actual size
+//is checked again while extracting
+func (z *ZipInflator) checkLimits(files []*zip.File) error {
+	if z.maxFiles > 0 && len(files) > z.maxFiles {
+		return fmt.Errorf("The results contain %v files, more than the maximum of %v (see %v)", len(files), z.maxFiles, MAXRESULTSFILES)
+	}
+	var size uint64
+	for _, f := range files {
+		size += f.UncompressedSize64
+	}
+	if z.maxSize > 0 && size > uint64(z.maxSize) {
+		return fmt.Errorf("The results take %v, more than the maximum of %v (see %v)", formatBytes(int64(size)), formatBytes(z.maxSize), MAXRESULTSSIZE)
 	}
 	return nil
 }
 
-func zipProcessor(file string, asZip bool) (io.WriteCloser, error) {
-	if asZip {
+//Returns where the entry is extracted or an error if the entry must not be extracted
+func (z *ZipInflator) entryPath(f *zip.File) (string, error) {
+	mode := f.Mode()
+	if mode&os.ModeSymlink != 0 {
+		return "", errors.New("symbolic links are not extracted")
+	}
+	if !mode.IsRegular() && !mode.IsDir() {
+		return "", errors.New("not a regular file")
+	}
+	name := filepath.FromSlash(f.Name)
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" || strings.HasPrefix(f.Name, "/") {
+		return "", errors.New("absolute paths are not extracted")
+	}
+	path := filepath.Join(z.folder, name)
+	rel, err := filepath.Rel(z.folder, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("the entry is outside the output folder")
+	}
+	return path, nil
+}
+
+//Extracts the file copying at most limit bytes (if limited) and keeps its modification time
+func extractFile(f *zip.File, path string, limit int64, limited bool) (written int64, err error) {
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	dest, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	var src io.Reader = rc
+	if limited {
+		//read one more byte to know if the limit was exceeded
+		src = io.LimitReader(rc, limit+1)
+	}
+	written, err = io.Copy(dest, src)
+	if closeErr := dest.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	if limited && written > limit {
+		return written, fmt.Errorf("The results are bigger than the maximum size (see %v)", MAXRESULTSSIZE)
+	}
+	if modified := f.Modified; !modified.IsZero() {
+		err = os.Chtimes(path, modified, modified)
+	}
+	return
+}
+
+func zipProcessor(file string, asZip bool, selection resultSelection) (io.WriteCloser, error) {
+	if asZip && selection.all() {
 		return os.Create(file)
+	} else if asZip {
+		return NewZipFilter(file, selection), nil
 	} else {
-		return NewZipInflator(file), nil
+		inflator := NewZipInflator(file)
+		inflator.selection = selection
+		return inflator, nil
 	}
 }
 
+//Formats a number of bytes using binary units
+func formatBytes(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %v", n, units[unit])
+	}
+	return fmt.Sprintf("%.1f %v", value, units[unit])
+}
+
+//Downloads the selected results of the job into output (a folder or, if zipped, a zip file)
+//reporting the progress through the renderer. What happens when the output already exists
+//depends on the ifExists policy. Returns false if the job has no results, and the path where
+//the results were stored
+func storeResults(link PipelineLink, jobId, output string, zipped bool, selection resultSelection, ifExists string, renderer *progressRenderer) (ok bool, stored string, err error) {
+	target, err := newOutputTarget(output, zipped, ifExists)
+	if err != nil {
+		return
+	}
+	stored = target.final
+	wc, err := zipProcessor(target.path, zipped, selection)
+	if err != nil {
+		target.discard()
+		return
+	}
+	inflator, isInflator := wc.(*ZipInflator)
+	if isInflator {
+		inflator.maxSize = int64(link.config.intValue(MAXRESULTSSIZE)) * 1024 * 1024
+		inflator.maxFiles = link.config.intValue(MAXRESULTSFILES)
+	}
+	progress := &downloadProgress{Writer: wc, renderer: renderer}
+	ok, err = link.SelectedResults(jobId, selection, progress)
+	progress.done()
+	if err != nil {
+		if aborter, canAbort := wc.(interface{ Abort() error }); canAbort {
+			aborter.Abort()
+		} else {
+			wc.Close()
+		}
+		target.discard()
+		return
+	}
+	if err = wc.Close(); err != nil || !ok {
+		//the existing output is kept
+		target.discard()
+		return
+	}
+	if isInflator {
+		for _, rejected := range inflator.Rejected {
+			fmt.Fprintf(renderer.out, "Warning: result entry not extracted, %v\n", rejected)
+		}
+	}
+	err = target.commit()
+	return
+}
+
 //gets the path for last id file
 func getLastIdPath(currentOs string) string {
 	var path string
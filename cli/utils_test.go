@@ -4,10 +4,13 @@ import (
 	"archive/zip"
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 var files = []struct {
@@ -321,3 +324,150 @@ func TestAssertJava(t *testing.T) {
 	}
 
 }
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		0:                      "0 B",
+		1023:                   "1023 B",
+		1536:                   "1.5 KB",
+		5 * 1024 * 1024:        "5.0 MB",
+		3 * 1024 * 1024 * 1024: "3.0 GB",
+	}
+	for n, expected := range tests {
+		if res := formatBytes(n); res != expected {
+			t.Errorf("Wrong format for %v: %v!=%v", n, res, expected)
+		}
+	}
+}
+
+//Tests that aborting the inflator discards the spooled data
+func TestZipInflatorAbort(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(folder)
+	zi := NewZipInflator(folder)
+	if _, err := zi.Write([]byte("half a zip")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	spool := zi.spool.Name()
+	if err := zi.Abort(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(spool); !os.IsNotExist(err) {
+		t.Errorf("The spool file wasn't removed")
+	}
+	if err := zi.Close(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+//Creates a zip with the given entries, the contents of symbolic links are their targets
+func createZip(t *testing.T, headers []zip.FileHeader, contents []string) []byte {
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for idx := range headers {
+		f, err := w.CreateHeader(&headers[idx])
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if _, err := f.Write([]byte(contents[idx])); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	return buf.Bytes()
+}
+
+//Tests that entries escaping the folder and symbolic links are rejected
+func TestZipInflatorRejected(t *testing.T) {
+	folder, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	defer os.RemoveAll(folder)
+	modified := time.Date(2015, 3, 4, 10, 0, 0, 0, time.UTC)
+	link := zip.FileHeader{Name: "link"}
+	link.SetMode(os.ModeSymlink | 0777)
+	headers := []zip.FileHeader{
+		{Name: "book/book.xml", Modified: modified},
+		{Name: "../escaped.txt"},
+		{Name: "book/../../escaped.txt"},
+		{Name: "/absolute.txt"},
+		link,
+	}
+	data := createZip(t, headers, []string{"<doc/>", "", "", "", "/etc/passwd"})
+	zi := NewZipInflator(folder)
+	zi.Write(data)
+	if err := zi.Close(); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	info, err := os.Stat(filepath.Join(folder, "book", "book.xml"))
+	if err != nil {
+		t.Fatalf("book.xml wasn't extracted: %v", err)
+	}
+	if !info.ModTime().Equal(modified) {
+		t.Errorf("Modification time not kept %v!=%v", info.ModTime(), modified)
+	}
+	if len(zi.Rejected) != 4 {
+		t.Errorf("Expected 4 rejected entries got %v", zi.Rejected)
+	}
+	if _, err := os.Lstat(filepath.Join(folder, "link")); !os.IsNotExist(err) {
+		t.Errorf("The symbolic link was extracted")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(folder), "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("An entry escaped the output folder")
+	}
+}
+
+//Tests the limits of the number of files and size
+func TestZipInflatorLimits(t *testing.T) {
+	headers := []zip.FileHeader{{Name: "one.txt"}, {Name: "two.txt"}}
+	data := createZip(t, headers, []string{"1234567890", "1234567890"})
+	for _, limits := range []struct{ size, files int }{{0, 1}, {15, 0}} {
+		folder, err := ioutil.TempDir("", "cli_")
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		zi := NewZipInflator(folder)
+		zi.maxSize = int64(limits.size)
+		zi.maxFiles = limits.files
+		zi.Write(data)
+		if err := zi.Close(); err == nil {
+			t.Errorf("Exceeding the limits %+v didn't error", limits)
+		}
+		os.RemoveAll(folder)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"90s": 90 * time.Second,
+		"2h":  2 * time.Hour,
+		"30":  30 * time.Second,
+	}
+	for value, expected := range tests {
+		if res, err := parseDuration(value); err != nil || res != expected {
+			t.Errorf("Parsing %v: expected %v got %v (%v)", value, expected, res, err)
+		}
+	}
+	for _, value := range []string{"", "soon", "-1m"} {
+		if _, err := parseDuration(value); err == nil {
+			t.Errorf("Parsing %q didn't error", value)
+		}
+	}
+}
+
+func TestLoadKeyMissing(t *testing.T) {
+	backup := keyFile
+	defer func() {
+		keyFile = backup
+	}()
+	keyFile = "keythatdoesntexist!"
+	if _, err := loadKey(); err == nil || !strings.Contains(err.Error(), "Could not find the key file") {
+		t.Errorf("Missing key file not reported %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package cli
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+const (
+	WATCH_PROCESSED = "processed" //sub-folder for the files that were converted
+	WATCH_FAILED    = "failed"    //sub-folder for the files that couldn't be converted
+)
+
+//Watches a folder and converts the files dropped into it
+type folderWatcher struct {
+	link     *PipelineLink
+	script   pipeline.Script
+	input    string                 //Script input the files are passed to
+	dir      string                 //Watched folder
+	output   string                 //Folder where to store the results
+	ifExists string                 //What to do when the results of a file already exist
+	interval time.Duration          //Time between scans
+	pending  map[string]os.FileInfo //Files seen in the last scan that were not processed yet
+	stuck    map[string]os.FileInfo //Files processed that couldn't be moved, skipped until they change
+	out      io.Writer
+}
+
+func AddWatchCommand(cli *Cli, link *PipelineLink) {
+	scriptId := ""
+	output := ""
+	input := ""
+	ifExists := ""
+	interval := 5
+	cmd := cli.AddCommand("watch", "Converts the files dropped into a folder", func(command string, args ...string) error {
+		script, err := link.Script(scriptId)
+		if err != nil {
+			return err
+		}
+		w := &folderWatcher{
+			link:     link,
+			script:   script,
+			input:    input,
+			dir:      args[0],
+			output:   output,
+			ifExists: ifExists,
+			interval: time.Duration(interval) * time.Second,
+			pending:  map[string]os.FileInfo{},
+			stuck:    map[string]os.FileInfo{},
+			out:      cli.Output,
+		}
+		if w.input == "" {
+			w.input = defaultInput(script)
+		}
+		if w.input == "" {
+			return fmt.Errorf("Script %v has no inputs", script.Id)
+		}
+		return w.watch()
+	})
+	cmd.SetArity(1, "DIRECTORY")
+	cmd.AddOption("script", "s", "Script used to convert the files", "", "SCRIPT", func(name, value string) error {
+		scriptId = value
+		return nil
+	}).Must(true)
+	cmd.AddOption("output", "o", "Directory where to store the results", "", "DIRECTORY", func(name, folder string) error {
+		output = folder
+		return nil
+	}).Must(true)
+	cmd.AddOption("input", "i", "Script input the files are passed to (by default the first required input)", "", "NAME", func(name, value string) error {
+		input = value
+		return nil
+	})
+	addIfExistsOption(cmd, &ifExists)
+	cmd.AddOption("interval", "", "Seconds between two scans of the folder (default 5)", "", "", func(name, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return ValidationError{fmt.Errorf("option %v must be a positive number (found %v)", name, value)}
+		}
+		interval = n
+		return nil
+	})
+}
+
+//Returns the name of the first required input of the script, or the first input if none is required
+func defaultInput(script pipeline.Script) string {
+	for _, input := range script.Inputs {
+		if input.Required {
+			return input.Name
+		}
+	}
+	if len(script.Inputs) > 0 {
+		return script.Inputs[0].Name
+	}
+	return ""
+}
+
+//Scans the folder until the process is killed
+func (w *folderWatcher) watch() error {
+	for _, sub := range []string{WATCH_PROCESSED, WATCH_FAILED} {
+		if err := mkdir(filepath.Join(w.dir, sub)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w.out, "Watching %v for new files\n", w.dir)
+	for {
+		if err := w.scan(); err != nil {
+			return err
+		}
+		time.Sleep(w.interval)
+	}
+}
+
+//Scans the folder once and converts the files that didn't change since the last scan.
+//Files that are still changing (e.g. being copied) are left for the next scan
+func (w *folderWatcher) scan() error {
+	entries, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ModTime().Before(entries[j].ModTime())
+	})
+	current := map[string]os.FileInfo{}
+	stuck := map[string]os.FileInfo{}
+	for _, info := range entries {
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		if prev, ok := w.stuck[info.Name()]; ok && sameFileInfo(prev, info) {
+			stuck[info.Name()] = info
+			continue
+		}
+		prev, seen := w.pending[info.Name()]
+		if !seen || !sameFileInfo(prev, info) {
+			current[info.Name()] = info
+			continue
+		}
+		status, err := w.process(info.Name())
+		if err != nil && !w.alive() {
+			//the webservice went away, keep the file for the next scan
+			fmt.Fprintf(w.out, "Lost connection to the webservice while converting %v\n", info.Name())
+			current[info.Name()] = info
+			w.reconnect()
+			continue
+		}
+		dest := WATCH_PROCESSED
+		if err != nil || status != "SUCCESS" {
+			dest = WATCH_FAILED
+		}
+		if err != nil {
+			fmt.Fprintf(w.out, "%v: %v\n", info.Name(), err)
+		} else {
+			fmt.Fprintf(w.out, "%v: %v\n", info.Name(), status)
+		}
+		if err := os.Rename(filepath.Join(w.dir, info.Name()), filepath.Join(w.dir, dest, info.Name())); err != nil {
+			//keep watching, the file isn't converted again unless it changes
+			fmt.Fprintf(w.out, "%v couldn't be moved to the %v folder: %v\n", info.Name(), dest, err)
+			stuck[info.Name()] = info
+		}
+	}
+	w.pending = current
+	w.stuck = stuck
+	return nil
+}
+
+//Checks if the file didn't change between two scans
+func sameFileInfo(prev, info os.FileInfo) bool {
+	return prev.Size() == info.Size() && prev.ModTime().Equal(info.ModTime())
+}
+
+//Converts a single file from the watched folder, the results are stored in a folder named after the
+//file, extension included so book.xml and book.epub don't end up in the same folder
+func (w *folderWatcher) process(name string) (status string, err error) {
+	path := filepath.Join(w.dir, name)
+	args := []string{"--" + getFlagName(w.input, "i-", nil)}
+	if w.link.IsLocal() {
+		if path, err = filepath.Abs(path); err != nil {
+			return
+		}
+		args = append(args, path)
+	} else {
+		//remote webservice, send the file within a zip
+		var data string
+		if data, err = zipSingleFile(path); err != nil {
+			return
+		}
+		defer os.Remove(data)
+		args = append(args, name, "--data", data)
+	}
+	jExec, err := parseScriptArgs(w.script, w.link, args)
+	if err != nil {
+		return
+	}
+	jExec.output = filepath.Join(w.output, name)
+	jExec.ifExists = w.ifExists
+	jExec.verbose = false
+	jExec.req.Background = false
+	jExec.unattended = true
+	fmt.Fprintf(w.out, "Converting %v\n", name)
+	_, status, _, err = jExec.execute(ioutil.Discard)
+	return
+}
+
+//Checks if the webservice is still reachable
+func (w *folderWatcher) alive() bool {
+	_, err := w.link.pipeline.Alive()
+	return err == nil
+}
+
+//Waits until the link is brought up again
+func (w *folderWatcher) reconnect() {
+	for {
+		err := bringUp(w.link)
+		if err == nil {
+			fmt.Fprintf(w.out, "Connected to the webservice again\n")
+			return
+		}
+		log.Printf("Couldn't bring up the webservice: %v", err)
+		time.Sleep(w.interval)
+	}
+}
+
+//Creates a temporary zip file containing the given file
+func zipSingleFile(path string) (zipPath string, err error) {
+	tmp, err := ioutil.TempFile("", "dp2_data_")
+	if err != nil {
+		return
+	}
+	zipPath = tmp.Name()
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(zipPath)
+		}
+	}()
+	zw := zip.NewWriter(tmp)
+	if err = zipFile(zw, path, filepath.Base(path)); err != nil {
+		return
+	}
+	err = zw.Close()
+	return
+}
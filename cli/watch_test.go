@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daisy/pipeline-clientlib-go"
+)
+
+func newTestWatcher(t *testing.T, script pipeline.Script) (*folderWatcher, string) {
+	dir, err := ioutil.TempDir("", "cli_")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for _, sub := range []string{WATCH_PROCESSED, WATCH_FAILED} {
+		if err := mkdir(filepath.Join(dir, sub)); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	link := &PipelineLink{pipeline: newPipelineTest(false), FsAllow: true}
+	return &folderWatcher{
+		link:     link,
+		script:   script,
+		input:    defaultInput(script),
+		dir:      dir,
+		output:   filepath.Join(dir, "out"),
+		interval: time.Millisecond,
+		pending:  map[string]os.FileInfo{},
+		stuck:    map[string]os.FileInfo{},
+		out:      ioutil.Discard,
+	}, dir
+}
+
+//Tests that files are only converted once they don't change anymore and are moved afterwards
+func TestWatcherScan(t *testing.T) {
+	w, dir := newTestWatcher(t, pipeline.Script{Id: "test", Inputs: SCRIPT.Inputs})
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "book.xml"), []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := w.scan(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "book.xml")); err != nil {
+		t.Errorf("The file was processed in the first scan")
+	}
+	if err := w.scan(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, WATCH_PROCESSED, "book.xml")); err != nil {
+		t.Errorf("The file wasn't moved to the processed folder")
+	}
+}
+
+//Tests that files that can't be converted end up in the failed folder
+func TestWatcherScanFailed(t *testing.T) {
+	//SCRIPT has a required option that is not given
+	w, dir := newTestWatcher(t, SCRIPT)
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "book.xml"), []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	w.scan()
+	if err := w.scan(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, WATCH_FAILED, "book.xml")); err != nil {
+		t.Errorf("The file wasn't moved to the failed folder")
+	}
+}
+
+//Tests that a file which can't be moved is reported and not converted again
+func TestWatcherScanNotMoved(t *testing.T) {
+	w, dir := newTestWatcher(t, pipeline.Script{Id: "test", Inputs: SCRIPT.Inputs})
+	defer os.RemoveAll(dir)
+	out := new(bytes.Buffer)
+	w.out = out
+	if err := ioutil.WriteFile(filepath.Join(dir, "book.xml"), []byte("<doc/>"), 0644); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	//a non-empty folder is in the way
+	if err := mkdir(filepath.Join(dir, WATCH_PROCESSED, "book.xml", "old")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := w.scan(); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if !strings.Contains(out.String(), "book.xml couldn't be moved to the processed folder") {
+		t.Errorf("The error wasn't reported %q", out.String())
+	}
+	if converted := strings.Count(out.String(), "Converting book.xml"); converted != 1 {
+		t.Errorf("The file was converted %v times", converted)
+	}
+}
+
+//Tests that files with the same name but another extension have their own results and that
+//existing results are handled following the if-exists policy
+func TestWatcherScanOutputs(t *testing.T) {
+	w, dir := newTestWatcher(t, pipeline.Script{Id: "test", Inputs: SCRIPT.Inputs})
+	defer os.RemoveAll(dir)
+	out := new(bytes.Buffer)
+	w.out = out
+	w.ifExists = IF_EXISTS_FAIL
+	for _, name := range []string{"book.xml", "book.epub"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("<doc/>"), 0644); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	//results of an earlier book.xml
+	if err := mkdir(filepath.Join(w.output, "book.xml")); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	w.scan()
+	if err := w.scan(); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, WATCH_PROCESSED, "book.epub")); err != nil {
+		t.Errorf("book.epub wasn't converted beside the results of book.xml: %q", out.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, WATCH_FAILED, "book.xml")); err != nil {
+		t.Errorf("The existing results of book.xml were not kept")
+	}
+	if !strings.Contains(out.String(), "book.xml: "+filepath.Join(w.output, "book.xml")+" already exists") {
+		t.Errorf("The existing results weren't reported %q", out.String())
+	}
+}
+
+func TestZipSingleFileError(t *testing.T) {
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "dp2_data_*"))
+	if _, err := zipSingleFile(filepath.Join(os.TempDir(), "dp2_missing_file.xml")); err == nil {
+		t.Fatalf("Zipping a missing file didn't error")
+	}
+	if after, _ := filepath.Glob(filepath.Join(os.TempDir(), "dp2_data_*")); len(after) != len(before) {
+		t.Errorf("The temporary zip file was left behind")
+	}
+}
+
+func TestDefaultInput(t *testing.T) {
+	if input := defaultInput(SCRIPT); input != "single" {
+		t.Errorf("Wrong default input %v", input)
+	}
+	script := pipeline.Script{Inputs: []pipeline.Input{
+		pipeline.Input{Name: "first"},
+		pipeline.Input{Name: "second", Required: true},
+	}}
+	if input := defaultInput(script); input != "second" {
+		t.Errorf("The required input wasn't chosen %v", input)
+	}
+}
@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+const (
+	WEBHOOK_RETRIES          = 3                   //times a failed notification is sent again by default
+	WEBHOOK_SIGNATURE_HEADER = "X-DP2-Signature" //sha256=HEX, the HMAC-SHA256 of the body with the secret
+)
+
+//Payload posted to the webhook once the job is finished
+type jobNotification struct {
+	Id       string `json:"id"`
+	Script   string `json:"script"`
+	Nicename string `json:"nicename,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	Status   string `json:"status"`
+	//dp2's own timings, the webservice doesn't tell when the job started or finished
+	FollowedSince time.Time      `json:"followed_since"` //when dp2 started following the job
+	Finished      time.Time      `json:"finished"`       //when dp2 saw the job finished
+	FollowedFor   string         `json:"followed_for"`   //time between both
+	Messages      map[string]int `json:"messages"`       //number of messages per level
+}
+
+//Posts job notifications to a URL
+type webhook struct {
+	url     string
+	secret  string
+	retries int
+	client  *http.Client
+}
+
+//Adds the command to follow a job and post a notification when it finishes
+func AddNotifyCommand(cli *Cli, link PipelineLink) {
+	lastId := new(bool)
+	hook := webhook{retries: WEBHOOK_RETRIES}
+	cmd := cli.AddCommand("notify", "Follows a job, typically sent with --background, and posts a JSON notification to the webhook when it finishes. Its timings are dp2's own: followed_since is when notify started following the job and finished when it saw the job finished, not the times on the server", func(command string, args ...string) error {
+		id, err := checkId(*lastId, command, args...)
+		if err != nil {
+			return err
+		}
+		if hook.secret == "" {
+			hook.secret, _ = link.config[WEBHOOKSECRET].(string)
+		}
+		hook.client = &http.Client{Timeout: time.Duration(link.config.intValue(TIMEOUT)) * time.Second}
+		notification, err := followForNotification(link, id)
+		if err != nil {
+			return linkError(err)
+		}
+		if err := hook.post(notification); err != nil {
+			return err
+		}
+		cli.Printf("Job %v finished with status %v, notification sent to %v\n", id, notification.Status, hook.url)
+		return nil
+	})
+	addLastId(cmd, lastId)
+	cmd.AddOption("webhook", "w", "URL where the notification is posted", "", "URL", func(name, value string) error {
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ValidationError{fmt.Errorf("%v is not a valid value for --%v, an http or https URL is expected", value, name)}
+		}
+		hook.url = value
+		return nil
+	}).Must(true)
+	cmd.AddOption("secret", "", "Sign the notification with HMAC-SHA256 using the secret, the signature is sent in the "+WEBHOOK_SIGNATURE_HEADER+" header (by default the "+WEBHOOKSECRET+" configuration)", "", "SECRET", func(name, value string) error {
+		hook.secret = value
+		return nil
+	})
+	cmd.AddOption("retries", "", fmt.Sprintf("Times the notification is sent again when the webhook can't be reached or answers with a server error (default %v)", WEBHOOK_RETRIES), "", "N", func(name, value string) error {
+		retries, err := strconv.Atoi(value)
+		if err != nil || retries < 0 {
+			return ValidationError{fmt.Errorf("%v is not a valid value for --%v", value, name)}
+		}
+		hook.retries = retries
+		return nil
+	})
+}
+
+//Follows the job until it finishes counting its messages
+func followForNotification(link PipelineLink, id string) (notification jobNotification, err error) {
+	job, err := link.Job(id)
+	if err != nil {
+		return
+	}
+	script := job.Script.Id
+	if script == "" {
+		script = path.Base(job.Script.Href)
+	}
+	notification = jobNotification{
+		Id:       job.Id,
+		Script:   script,
+		Nicename: job.Nicename,
+		Priority: job.Priority,
+		Status:   job.Status,
+		FollowedSince: time.Now(),
+		Messages: map[string]int{},
+	}
+	messages := make(chan Message)
+	done := make(chan struct{})
+	defer stopFollowing(messages, done)
+	go getAsyncMessages(link, id, messages, done)
+	for msg := range messages {
+		if msg.Error != nil {
+			err = msg.Error
+			return
+		}
+		if msg.Message != "" {
+			notification.Messages[msg.Level]++
+		}
+		if msg.Status != "" {
+			notification.Status = msg.Status
+		}
+	}
+	notification.Finished = time.Now()
+	notification.FollowedFor = notification.Finished.Sub(notification.FollowedSince).Round(time.Millisecond).String()
+	return
+}
+
+//Returns the signature of the body to send in the signature header
+func signature(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//Posts the notification, retrying with increasing waits when the webhook can't be reached,
+//answers too many requests or a server error
+func (w webhook) post(notification jobNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = w.send(body)
+		if err == nil || !retry || attempt >= w.retries {
+			return err
+		}
+		sleep(backoff(attempt + 1), nil)
+	}
+}
+
+//Sends the body once, returns if the failure is worth retrying
+func (w webhook) send(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		req.Header.Set(WEBHOOK_SIGNATURE_HEADER, signature(body, w.secret))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, ConnectionError{fmt.Errorf("Could not post the notification to %v: %v", w.url, err)}
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("The webhook %v answered %v", w.url, resp.Status)
+}
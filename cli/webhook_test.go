@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+//Webhook answering the given status codes in turn, the last one from then on
+func webhookStandIn(t *testing.T, codes ...int) (*httptest.Server, *[][]byte, *[]string) {
+	bodies, signatures := [][]byte{}, []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(WEBHOOK_SIGNATURE_HEADER))
+		code := codes[len(codes)-1]
+		if len(bodies) <= len(codes) {
+			code = codes[len(bodies)-1]
+		}
+		w.WriteHeader(code)
+	}))
+	return server, &bodies, &signatures
+}
+
+func makeNotifyCli(t *testing.T) *Cli {
+	cli, link, _ := makeReturningCli(nil, t)
+	AddNotifyCommand(cli, link)
+	overrideOutput(cli)
+	return cli
+}
+
+func TestNotifyCommand(t *testing.T) {
+	defer mockSleep()()
+	server, bodies, signatures := webhookStandIn(t, http.StatusServiceUnavailable, http.StatusOK)
+	defer server.Close()
+	cli := makeNotifyCli(t)
+	if err := cli.Run([]string{"notify", "--webhook", server.URL, "--secret", "key", "job1"}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(*bodies) != 2 {
+		t.Fatalf("The notification wasn't sent again, %v requests", len(*bodies))
+	}
+	body := (*bodies)[1]
+	if (*signatures)[1] != signature(body, "key") {
+		t.Errorf("Wrong signature %v", (*signatures)[1])
+	}
+	notification := jobNotification{}
+	if err := json.Unmarshal(body, &notification); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if notification.Id != "job1" || notification.Status != "SUCCESS" || notification.Messages["WARN"] != 1 {
+		t.Errorf("Wrong notification %s", body)
+	}
+	if notification.Finished.Before(notification.FollowedSince) || notification.FollowedFor == "" {
+		t.Errorf("Wrong timings %s", body)
+	}
+	if !bytes.Contains(body, []byte(`"followed_since"`)) || !bytes.Contains(body, []byte(`"followed_for"`)) {
+		t.Errorf("Timings not named after dp2's following %s", body)
+	}
+}
+
+func TestNotifyCommandRetries(t *testing.T) {
+	defer mockSleep()()
+	server, bodies, signatures := webhookStandIn(t, http.StatusInternalServerError)
+	defer server.Close()
+	cli := makeNotifyCli(t)
+	if err := cli.Run([]string{"notify", "--webhook", server.URL, "--retries", "2", "job1"}); err == nil {
+		t.Errorf("Failed notification didn't error")
+	}
+	if len(*bodies) != 3 {
+		t.Errorf("Wrong number of attempts %v", len(*bodies))
+	}
+	if (*signatures)[0] != "" {
+		t.Errorf("Notification signed without secret")
+	}
+}
+
+//Client errors won't go away by sending the notification again
+func TestNotifyCommandClientError(t *testing.T) {
+	defer mockSleep()()
+	server, bodies, _ := webhookStandIn(t, http.StatusBadRequest)
+	defer server.Close()
+	cli := makeNotifyCli(t)
+	if err := cli.Run([]string{"notify", "--webhook", server.URL, "job1"}); err == nil {
+		t.Errorf("Rejected notification didn't error")
+	}
+	if len(*bodies) != 1 {
+		t.Errorf("Rejected notification sent again")
+	}
+	if err := makeNotifyCli(t).Run([]string{"notify", "--webhook", "ftp://example.org", "job1"}); err == nil {
+		t.Errorf("Invalid webhook didn't error")
+	}
+}
@@ -1,15 +1,65 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
 
+	"github.com/bertfrees/go-subcommand"
 	"github.com/daisy/pipeline-cli-go/cli"
 )
 
 var minJavaVersion = 11
 
+//Exit codes
+const (
+	EXIT_SUCCESS     = 0 //the command succeeded, or the job finished with status SUCCESS
+	EXIT_ERROR       = 1 //any other error
+	EXIT_JOB_FAIL    = 2 //the job finished with status FAIL
+	EXIT_JOB_ERROR   = 3 //the job finished with status ERROR
+	EXIT_VALIDATION  = 4 //the job request or the arguments are not valid
+	EXIT_CONNECTION  = 5 //the webservice can't be reached
+	EXIT_AUTH        = 6 //the credentials are missing or rejected
+	EXIT_TIMEOUT     = 7 //the webservice took too long to answer
+	EXIT_HOOK        = 8 //the job succeeded but the hook run after it failed
+	EXIT_JOB_TIMEOUT = 9 //the job didn't finish within the job timeout
+)
+
+//Maps the error returned by the command to the exit code
+func exitCode(err error) int {
+	var jobErr cli.JobStatusError
+	var validationErr cli.ValidationError
+	var parsingErr subcommand.ParsingError
+	var connectionErr cli.ConnectionError
+	var authErr cli.AuthError
+	var timeoutErr cli.TimeoutError
+	var jobTimeoutErr cli.JobTimeoutError
+	var hookErr cli.HookError
+	switch {
+	case err == nil:
+		return EXIT_SUCCESS
+	case errors.As(err, &jobErr):
+		if jobErr.Status == "FAIL" {
+			return EXIT_JOB_FAIL
+		}
+		return EXIT_JOB_ERROR
+	case errors.As(err, &validationErr), errors.As(err, &parsingErr):
+		return EXIT_VALIDATION
+	case errors.As(err, &authErr):
+		return EXIT_AUTH
+	case errors.As(err, &jobTimeoutErr):
+		return EXIT_JOB_TIMEOUT
+	case errors.As(err, &timeoutErr):
+		return EXIT_TIMEOUT
+	case errors.As(err, &connectionErr):
+		return EXIT_CONNECTION
+	case errors.As(err, &hookErr):
+		return EXIT_HOOK
+	}
+	return EXIT_ERROR
+}
+
 func main() {
 	log.SetFlags(log.Lshortfile)
 	cnf := cli.NewConfig()
@@ -31,10 +81,14 @@ func main() {
 
 	if err != nil {
 		fmt.Printf("Error creating client:\n\t%v\n", err)
-		os.Exit(-1)
+		os.Exit(exitCode(err))
 	}
 
 	cli.AddJobStatusCommand(comm, *link)
+	cli.AddAttachCommand(comm, *link)
+	cli.AddNotifyCommand(comm, *link)
+	cli.AddSubmitCommand(comm, *link)
+	cli.AddRerunCommand(comm, link)
 	cli.AddDeleteCommand(comm, *link)
 	cli.AddResultsCommand(comm, *link)
 	cli.AddJobsCommand(comm, *link)
@@ -45,6 +99,9 @@ func main() {
 	cli.AddCleanCommand(comm, *link)
 	cli.AddHaltCommand(comm, *link)
 	cli.AddVersionCommand(comm, link)
+	cli.AddBatchCommand(comm, link)
+	cli.AddWatchCommand(comm, link)
+	cli.AddPresetCommand(comm, link)
 	//admin commands
 	comm.AddClientListCommand(*link)
 	comm.AddNewClientCommand(*link)
@@ -57,6 +114,6 @@ func main() {
 	err = comm.Run(os.Args[1:])
 	if err != nil {
 		fmt.Printf("Error:\n\t%v\n", err)
-		os.Exit(-1)
+		os.Exit(exitCode(err))
 	}
 }
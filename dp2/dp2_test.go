@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bertfrees/go-subcommand"
+	"github.com/daisy/pipeline-cli-go/cli"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		code int
+	}{
+		{nil, EXIT_SUCCESS},
+		{errors.New("any"), EXIT_ERROR},
+		{cli.JobStatusError{Status: "FAIL"}, EXIT_JOB_FAIL},
+		{cli.ValidationError{Err: errors.New("invalid")}, EXIT_VALIDATION},
+		{subcommand.ParsingError{Description: "--foo is not a valid flag for dp2"}, EXIT_VALIDATION},
+		{cli.JobTimeoutError{JobId: "job1"}, EXIT_JOB_TIMEOUT},
+	} {
+		if code := exitCode(test.err); code != test.code {
+			t.Errorf("Expected exit code %v for %#v got %v", test.code, test.err, code)
+		}
+	}
+}
+
+func TestExitCodeBadFlag(t *testing.T) {
+	for _, args := range [][]string{
+		{"--timeout", "soon", "help"},
+		{"--not-a-flag", "help"},
+	} {
+		comm, err := cli.NewCli("dp2", cli.NewLink(cli.NewConfig()))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if code := exitCode(comm.Run(args)); code != EXIT_VALIDATION {
+			t.Errorf("Expected exit code %v for %v got %v", EXIT_VALIDATION, args, code)
+		}
+	}
+}